@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -32,12 +33,21 @@ type myBackend struct {
 	lock sync.RWMutex
 	// stores the client for the target API, myApi
 	client *myClient
+
+	// storage and handlers shared with the HashiCups solution
+	config *hcframework.Config
+	roles  *hcframework.Roles
+	tokens *hcframework.LeaseSecret
 }
 
 // createMyBackend defines the target API backend for Vault.
 // It must include each path and the secrets it will store.
 func createMyBackend() *myBackend {
 	b := new(myBackend)
+	b.config = newConfigStore(b)
+	b.roles = newRoleStore()
+	b.tokens = b.myToken()
+
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(backendHelp),
 		PathsSpecial: &logical.Paths{
@@ -54,8 +64,8 @@ func createMyBackend() *myBackend {
 				pathCredentials(b),
 			},
 		),
-		Secrets:     []*framework.Secret{
-			b.myToken(),
+		Secrets: []*framework.Secret{
+			b.tokens.Secret(),
 		},
 		BackendType: logical.TypeLogical,
 		Invalidate:  b.invalidate,
@@ -92,7 +102,7 @@ func (b *myBackend) getClient(ctx context.Context, s logical.Storage) (*myClient
 	b.lock.Lock()
 	unlockFunc = b.lock.Unlock
 
-	config, err := getConfig(ctx, s)
+	config, err := b.getConfig(ctx, s)
 	if err != nil {
 		return nil, err
 	}
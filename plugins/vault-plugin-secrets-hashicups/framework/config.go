@@ -0,0 +1,165 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// DefaultConfigKey is the storage key used when Config.Key is empty.
+const DefaultConfigKey = "config"
+
+// Config stores the configuration of a backend in a single
+// storage entry and provides the handlers for its path.
+type Config struct {
+	// Key is the storage key of the configuration.
+	// It defaults to DefaultConfigKey.
+	Key string
+
+	// New returns an empty configuration.
+	New func() Entry
+
+	// Encode and Decode replace plain JSON encoding when set.
+	Encode EncodeFunc
+	Decode DecodeFunc
+
+	// OnWrite, if set, is called after the configuration is
+	// written or deleted with the previous and the current
+	// configuration, either of which may be nil. Its error is
+	// returned to the caller, but the write is not undone.
+	OnWrite func(ctx context.Context, s logical.Storage, previous, current Entry) error
+
+	// OnChange, if set, is called after the configuration is
+	// written or deleted, for example to reset a cached client.
+	OnChange func()
+}
+
+func (c *Config) key() string {
+	if c.Key == "" {
+		return DefaultConfigKey
+	}
+	return c.Key
+}
+
+func (c *Config) store() store {
+	return store{new: c.New, encode: c.Encode, decode: c.Decode}
+}
+
+func (c *Config) changed() {
+	if c.OnChange != nil {
+		c.OnChange()
+	}
+}
+
+// Get returns the stored configuration, or nil if there is none.
+func (c *Config) Get(ctx context.Context, s logical.Storage) (Entry, error) {
+	e, err := c.store().get(ctx, s, c.key())
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration: %w", err)
+	}
+	return e, nil
+}
+
+// Put stores the configuration.
+func (c *Config) Put(ctx context.Context, s logical.Storage, e Entry) error {
+	return c.store().put(ctx, s, c.key(), e)
+}
+
+// ExistenceCheck reports whether the configuration exists, so that
+// writes are dispatched as create or update operations.
+func (c *Config) ExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	out, err := req.Storage.Get(ctx, c.key())
+	if err != nil {
+		return false, fmt.Errorf("existence check failed: %w", err)
+	}
+
+	return out != nil, nil
+}
+
+// HandleRead returns the non-sensitive fields of the configuration.
+func (c *Config) HandleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := c.Get(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: config.ResponseData(),
+	}, nil
+}
+
+// HandleWrite creates or updates the configuration.
+func (c *Config) HandleWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := c.Get(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	createOperation := (req.Operation == logical.CreateOperation)
+
+	if config == nil {
+		if !createOperation {
+			return nil, errors.New("config not found during update operation")
+		}
+		config = c.New()
+	}
+
+	// Update changes config in place, so read the
+	// previous configuration again for OnWrite.
+	var previous Entry
+	if c.OnWrite != nil && !createOperation {
+		if previous, err = c.Get(ctx, req.Storage); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Update(d, createOperation); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := c.Put(ctx, req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	c.changed()
+
+	if c.OnWrite != nil {
+		if err := c.OnWrite(ctx, req.Storage, previous, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// HandleDelete removes the configuration.
+func (c *Config) HandleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var previous Entry
+	if c.OnWrite != nil {
+		var err error
+		if previous, err = c.Get(ctx, req.Storage); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Storage.Delete(ctx, c.key()); err != nil {
+		return nil, err
+	}
+
+	c.changed()
+
+	if c.OnWrite != nil && previous != nil {
+		if err := c.OnWrite(ctx, req.Storage, previous, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,118 @@
+package framework
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfig checks the config handlers against
+// storage, including the OnChange hook.
+func TestConfig(t *testing.T) {
+	s := new(logical.InmemStorage)
+
+	changes := 0
+	c := &Config{
+		New:      newTestEntry,
+		OnChange: func() { changes++ },
+	}
+
+	t.Run("Read Missing Config", func(t *testing.T) {
+		resp, err := testRequest(t, c.HandleRead, s, logical.ReadOperation, nil)
+		require.NoError(t, err)
+		require.Nil(t, resp)
+	})
+
+	t.Run("Update Missing Config", func(t *testing.T) {
+		_, err := testRequest(t, c.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{
+			"value": "a",
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("Create Without Required Field", func(t *testing.T) {
+		resp, err := testRequest(t, c.HandleWrite, s, logical.CreateOperation, nil)
+		require.NoError(t, err)
+		require.True(t, resp.IsError())
+		require.Equal(t, 0, changes)
+	})
+
+	t.Run("Create Config", func(t *testing.T) {
+		resp, err := testRequest(t, c.HandleWrite, s, logical.CreateOperation, map[string]interface{}{
+			"value":  "a",
+			"secret": "hunter2",
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+		require.Equal(t, 1, changes)
+
+		exists, err := c.ExistenceCheck(context.Background(), &logical.Request{Storage: s}, nil)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		entry, err := s.Get(context.Background(), DefaultConfigKey)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+	})
+
+	t.Run("Update Config", func(t *testing.T) {
+		_, err := testRequest(t, c.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{
+			"value": "b",
+		})
+		require.NoError(t, err)
+
+		resp, err := testRequest(t, c.HandleRead, s, logical.ReadOperation, nil)
+		require.NoError(t, err)
+		require.Equal(t, "b", resp.Data["value"])
+		require.NotContains(t, resp.Data, "secret")
+
+		config, err := c.Get(context.Background(), s)
+		require.NoError(t, err)
+		require.Equal(t, "hunter2", config.(*testEntry).Secret)
+	})
+
+	t.Run("Delete Config", func(t *testing.T) {
+		_, err := testRequest(t, c.HandleDelete, s, logical.DeleteOperation, nil)
+		require.NoError(t, err)
+		require.Equal(t, 3, changes)
+
+		exists, err := c.ExistenceCheck(context.Background(), &logical.Request{Storage: s}, nil)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+}
+
+// TestConfigOnWrite checks that OnWrite sees the configuration
+// from before and after each write and delete.
+func TestConfigOnWrite(t *testing.T) {
+	s := new(logical.InmemStorage)
+
+	var previous, current []string
+	value := func(e Entry) string {
+		if e == nil {
+			return ""
+		}
+		return e.(*testEntry).Value
+	}
+
+	c := &Config{
+		New: newTestEntry,
+		OnWrite: func(ctx context.Context, s logical.Storage, p, c Entry) error {
+			previous = append(previous, value(p))
+			current = append(current, value(c))
+			return nil
+		},
+	}
+
+	_, err := testRequest(t, c.HandleWrite, s, logical.CreateOperation, map[string]interface{}{"value": "a"})
+	require.NoError(t, err)
+	_, err = testRequest(t, c.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{"value": "b"})
+	require.NoError(t, err)
+	_, err = testRequest(t, c.HandleDelete, s, logical.DeleteOperation, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"", "a", "b"}, previous)
+	require.Equal(t, []string{"a", "b", ""}, current)
+}
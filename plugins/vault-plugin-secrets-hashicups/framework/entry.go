@@ -0,0 +1,83 @@
+// Package framework contains the pieces shared by the HashiCups
+// secrets engine and the tutorial skeleton: storage and handlers
+// for a configuration entry and for roles, and a leased secret
+// that is renewed with the TTLs of the role it was issued from.
+// Fields derives the path fields, read responses and updates of
+// an entry from the tags on its struct.
+//
+// The package builds on the Vault SDK framework package, so
+// importers usually give it a name such as hcframework.
+package framework
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Entry is implemented by the configuration and role
+// types managed by Config and Roles.
+type Entry interface {
+	// Update applies the fields of a write request to the entry.
+	// create is true when the entry did not exist before the
+	// request, so any required field must be present. The
+	// error is returned to the caller as a bad request.
+	Update(d *framework.FieldData, create bool) error
+
+	// ResponseData returns the fields returned when the entry
+	// is read. Sensitive fields must be left out.
+	ResponseData() map[string]interface{}
+}
+
+// EncodeFunc creates the storage entry for an entry at key.
+type EncodeFunc func(key string, e Entry) (*logical.StorageEntry, error)
+
+// DecodeFunc decodes a storage entry into e.
+type DecodeFunc func(se *logical.StorageEntry, e Entry) error
+
+// store reads and writes entries of a single type,
+// as plain JSON unless encode and decode are set.
+type store struct {
+	new    func() Entry
+	encode EncodeFunc
+	decode DecodeFunc
+}
+
+func (s store) get(ctx context.Context, storage logical.Storage, key string) (Entry, error) {
+	se, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if se == nil {
+		return nil, nil
+	}
+
+	e := s.new()
+	if s.decode != nil {
+		err = s.decode(se, e)
+	} else {
+		err = se.DecodeJSON(e)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (s store) put(ctx context.Context, storage logical.Storage, key string, e Entry) error {
+	var se *logical.StorageEntry
+	var err error
+	if s.encode != nil {
+		se, err = s.encode(key, e)
+	} else {
+		se, err = logical.StorageEntryJSON(key, e)
+	}
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, se)
+}
@@ -0,0 +1,110 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// testEntry is a minimal entry with a required field, a
+// sensitive field that is never read back, and a TTL.
+type testEntry struct {
+	Value  string        `json:"value"`
+	Secret string        `json:"secret"`
+	TTL    time.Duration `json:"ttl"`
+}
+
+func (e *testEntry) Update(d *framework.FieldData, create bool) error {
+	if value, ok := d.GetOk("value"); ok {
+		e.Value = value.(string)
+	} else if create {
+		return errors.New("missing value")
+	}
+
+	if secret, ok := d.GetOk("secret"); ok {
+		e.Secret = secret.(string)
+	}
+
+	if ttl, ok := d.GetOk("ttl"); ok {
+		e.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+
+	return nil
+}
+
+func (e *testEntry) ResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"value": e.Value,
+		"ttl":   int64(e.TTL.Seconds()),
+	}
+}
+
+func (e *testEntry) LeaseTTLs() (time.Duration, time.Duration) {
+	return e.TTL, 0
+}
+
+var testFields = map[string]*framework.FieldSchema{
+	"value":  {Type: framework.TypeString},
+	"secret": {Type: framework.TypeString},
+	"ttl":    {Type: framework.TypeDurationSecond},
+}
+
+func newTestEntry() Entry {
+	return new(testEntry)
+}
+
+// testRequest runs a request against the handler with the test fields.
+func testRequest(t *testing.T, handler framework.OperationFunc, s logical.Storage, op logical.Operation, data map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	schema := make(map[string]*framework.FieldSchema, len(testFields)+1)
+	for k, v := range testFields {
+		schema[k] = v
+	}
+	schema[RoleNameField] = &framework.FieldSchema{Type: framework.TypeLowerCaseString}
+
+	return handler(context.Background(), &logical.Request{
+		Operation: op,
+		Storage:   s,
+	}, &framework.FieldData{
+		Raw:    data,
+		Schema: schema,
+	})
+}
+
+// TestStoreEncoding checks that the encode and
+// decode hooks replace plain JSON encoding.
+func TestStoreEncoding(t *testing.T) {
+	ctx := context.Background()
+	s := new(logical.InmemStorage)
+
+	var encoded, decoded bool
+	st := store{
+		new: newTestEntry,
+		encode: func(key string, e Entry) (*logical.StorageEntry, error) {
+			encoded = true
+			return logical.StorageEntryJSON(key, e)
+		},
+		decode: func(se *logical.StorageEntry, e Entry) error {
+			decoded = true
+			return se.DecodeJSON(e)
+		},
+	}
+
+	err := st.put(ctx, s, "key", &testEntry{Value: "a"})
+	require.NoError(t, err)
+	require.True(t, encoded)
+
+	e, err := st.get(ctx, s, "key")
+	require.NoError(t, err)
+	require.True(t, decoded)
+	require.Equal(t, "a", e.(*testEntry).Value)
+
+	e, err = st.get(ctx, s, "missing")
+	require.NoError(t, err)
+	require.Nil(t, e)
+}
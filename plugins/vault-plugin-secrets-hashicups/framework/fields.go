@@ -0,0 +1,201 @@
+package framework
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// Struct tags read by NewFields. Only struct fields with a
+// field tag are exposed on the path; the others are stored
+// but never read from or returned to the caller.
+//
+//	Username string `json:"username" field:"username,required" description:"The username" display:"Username"`
+//
+// The field tag holds the path field name followed by any of:
+//
+//	required   the field must be set when the entry is created
+//	sensitive  the field is never returned when the entry is read
+const (
+	fieldTag       = "field"
+	descriptionTag = "description"
+	displayTag     = "display"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Fields describes the path fields of a struct type,
+// derived from the tags on its fields.
+type Fields struct {
+	kind   string
+	typ    reflect.Type
+	fields []field
+}
+
+type field struct {
+	name        string
+	index       int
+	schemaType  framework.FieldType
+	description string
+	display     string
+	required    bool
+	sensitive   bool
+}
+
+// NewFields reads the tags of v, a struct or pointer to a struct.
+// kind names the entry in error messages, such as "role". It panics
+// if a tagged field has a type that cannot be mapped to a path
+// field, so it is meant to be called when the package is loaded.
+func NewFields(kind string, v interface{}) *Fields {
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("fields: %s is not a struct", typ))
+	}
+
+	f := &Fields{kind: kind, typ: typ}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag, ok := sf.Tag.Lookup(fieldTag)
+		if !ok {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		fd := field{
+			name:        opts[0],
+			index:       i,
+			schemaType:  schemaType(sf.Type),
+			description: sf.Tag.Get(descriptionTag),
+			display:     sf.Tag.Get(displayTag),
+		}
+		if fd.name == "" {
+			panic(fmt.Sprintf("fields: %s.%s has no field name", typ, sf.Name))
+		}
+		if fd.schemaType == framework.TypeInvalid {
+			panic(fmt.Sprintf("fields: %s.%s has unsupported type %s", typ, sf.Name, sf.Type))
+		}
+
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "required":
+				fd.required = true
+			case "sensitive":
+				fd.sensitive = true
+			default:
+				panic(fmt.Sprintf("fields: %s.%s has unknown option %q", typ, sf.Name, opt))
+			}
+		}
+
+		f.fields = append(f.fields, fd)
+	}
+
+	return f
+}
+
+// schemaType maps a Go type to the type of its path field.
+func schemaType(t reflect.Type) framework.FieldType {
+	if t == durationType {
+		return framework.TypeDurationSecond
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return framework.TypeString
+	case reflect.Int, reflect.Int64:
+		return framework.TypeInt
+	case reflect.Bool:
+		return framework.TypeBool
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return framework.TypeCommaStringSlice
+		}
+	}
+
+	return framework.TypeInvalid
+}
+
+// Schema returns the path fields. The map is new on every
+// call, so callers may add fields such as the role name.
+func (f *Fields) Schema() map[string]*framework.FieldSchema {
+	schema := make(map[string]*framework.FieldSchema, len(f.fields))
+	for _, fd := range f.fields {
+		s := &framework.FieldSchema{
+			Type:        fd.schemaType,
+			Description: fd.description,
+			Required:    fd.required,
+		}
+		if fd.display != "" || fd.sensitive {
+			s.DisplayAttrs = &framework.DisplayAttributes{
+				Name:      fd.display,
+				Sensitive: fd.sensitive,
+			}
+		}
+		schema[fd.name] = s
+	}
+	return schema
+}
+
+// ResponseData returns the fields of v that are not sensitive.
+// Durations are returned in seconds.
+func (f *Fields) ResponseData(v interface{}) map[string]interface{} {
+	rv := f.value(v)
+
+	data := make(map[string]interface{}, len(f.fields))
+	for _, fd := range f.fields {
+		if fd.sensitive {
+			continue
+		}
+
+		fv := rv.Field(fd.index)
+		if fv.Type() == durationType {
+			data[fd.name] = fv.Interface().(time.Duration).Seconds()
+			continue
+		}
+		data[fd.name] = fv.Interface()
+	}
+	return data
+}
+
+// Update sets the fields of v that are present in the request. When
+// create is true, missing required fields are an error and the other
+// missing fields are set to their default value.
+func (f *Fields) Update(v interface{}, d *framework.FieldData, create bool) error {
+	rv := f.value(v)
+
+	for _, fd := range f.fields {
+		raw, ok := d.GetOk(fd.name)
+		if !ok {
+			if !create {
+				continue
+			}
+			if fd.required {
+				return fmt.Errorf("missing %s in %s", fd.name, f.kind)
+			}
+			raw = d.Get(fd.name)
+		}
+
+		fv := rv.Field(fd.index)
+		if fv.Type() == durationType {
+			fv.SetInt(int64(time.Duration(raw.(int)) * time.Second))
+			continue
+		}
+		fv.Set(reflect.ValueOf(raw).Convert(fv.Type()))
+	}
+
+	return nil
+}
+
+// value returns the struct that v points to.
+func (f *Fields) value(v interface{}) reflect.Value {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Type() != f.typ {
+		panic(fmt.Sprintf("fields: expected *%s, got %T", f.typ, v))
+	}
+	return rv.Elem()
+}
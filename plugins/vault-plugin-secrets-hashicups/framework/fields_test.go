@@ -0,0 +1,112 @@
+package framework
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/stretchr/testify/require"
+)
+
+type testTaggedEntry struct {
+	Version  int           `json:"version"`
+	Username string        `json:"username" field:"username,required" display:"Username" description:"The username"`
+	Password string        `json:"password" field:"password,sensitive" description:"The password"`
+	Enabled  bool          `json:"enabled" field:"enabled"`
+	Count    int           `json:"count" field:"count"`
+	Scopes   []string      `json:"scopes" field:"scopes"`
+	TTL      time.Duration `json:"ttl" field:"ttl"`
+}
+
+var testTaggedFields = NewFields("test entry", testTaggedEntry{})
+
+func testTaggedData(raw map[string]interface{}) *framework.FieldData {
+	return &framework.FieldData{
+		Raw:    raw,
+		Schema: testTaggedFields.Schema(),
+	}
+}
+
+// TestFields checks the schema, response and
+// update logic derived from struct tags.
+func TestFields(t *testing.T) {
+	t.Run("Schema", func(t *testing.T) {
+		schema := testTaggedFields.Schema()
+		require.Len(t, schema, 6)
+		require.NotContains(t, schema, "version")
+
+		require.Equal(t, framework.TypeString, schema["username"].Type)
+		require.True(t, schema["username"].Required)
+		require.Equal(t, "The username", schema["username"].Description)
+		require.Equal(t, "Username", schema["username"].DisplayAttrs.Name)
+
+		require.True(t, schema["password"].DisplayAttrs.Sensitive)
+		require.Equal(t, framework.TypeBool, schema["enabled"].Type)
+		require.Equal(t, framework.TypeInt, schema["count"].Type)
+		require.Equal(t, framework.TypeCommaStringSlice, schema["scopes"].Type)
+		require.Equal(t, framework.TypeDurationSecond, schema["ttl"].Type)
+		require.Nil(t, schema["ttl"].DisplayAttrs)
+
+		// every call returns a new map
+		schema["name"] = &framework.FieldSchema{}
+		require.NotContains(t, testTaggedFields.Schema(), "name")
+	})
+
+	t.Run("Create Without Required Field", func(t *testing.T) {
+		e := new(testTaggedEntry)
+		err := testTaggedFields.Update(e, testTaggedData(nil), true)
+		require.EqualError(t, err, "missing username in test entry")
+	})
+
+	t.Run("Create And Update", func(t *testing.T) {
+		e := &testTaggedEntry{Version: 1}
+		err := testTaggedFields.Update(e, testTaggedData(map[string]interface{}{
+			"username": "vault",
+			"password": "hunter2",
+			"enabled":  true,
+			"scopes":   "a,b",
+			"ttl":      "1m",
+		}), true)
+		require.NoError(t, err)
+		require.Equal(t, &testTaggedEntry{
+			Version:  1,
+			Username: "vault",
+			Password: "hunter2",
+			Enabled:  true,
+			Scopes:   []string{"a", "b"},
+			TTL:      time.Minute,
+		}, e)
+
+		err = testTaggedFields.Update(e, testTaggedData(map[string]interface{}{
+			"count": 3,
+		}), false)
+		require.NoError(t, err)
+		require.Equal(t, "vault", e.Username)
+		require.Equal(t, 3, e.Count)
+		require.Equal(t, time.Minute, e.TTL)
+
+		require.Equal(t, map[string]interface{}{
+			"username": "vault",
+			"enabled":  true,
+			"count":    3,
+			"scopes":   []string{"a", "b"},
+			"ttl":      float64(60),
+		}, testTaggedFields.ResponseData(e))
+	})
+
+	t.Run("Invalid Tags", func(t *testing.T) {
+		require.Panics(t, func() {
+			NewFields("bad", struct {
+				Value float64 `field:"value"`
+			}{})
+		})
+		require.Panics(t, func() {
+			NewFields("bad", struct {
+				Value string `field:"value,secret"`
+			}{})
+		})
+		require.Panics(t, func() {
+			testTaggedFields.ResponseData(testTaggedEntry{})
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// RoleInternalDataKey is the key of the secret internal
+// data holding the name of the role a lease was issued from.
+const RoleInternalDataKey = "role"
+
+// LeaseRole is implemented by roles that set the
+// TTLs of the secrets issued from them.
+type LeaseRole interface {
+	// LeaseTTLs returns the TTL and maximum TTL of a lease.
+	// Zero values use the mount or system defaults.
+	LeaseTTLs() (ttl, maxTTL time.Duration)
+}
+
+// LeaseSecret describes a secret issued from a role. Its leases
+// are renewed with the current TTLs of that role, and renewal
+// fails once the role has been deleted.
+type LeaseSecret struct {
+	// Type is the secret type stored in the lease.
+	Type string
+
+	// Fields describes the secret data.
+	Fields map[string]*framework.FieldSchema
+
+	// Roles looks up the role a lease was issued from.
+	Roles *Roles
+
+	// Revoke revokes the secret in the target API.
+	Revoke framework.OperationFunc
+
+	secret *framework.Secret
+}
+
+// Secret returns the framework secret to register with the backend.
+func (l *LeaseSecret) Secret() *framework.Secret {
+	if l.secret == nil {
+		l.secret = &framework.Secret{
+			Type:   l.Type,
+			Fields: l.Fields,
+			Revoke: l.Revoke,
+			Renew:  l.renew,
+		}
+	}
+	return l.secret
+}
+
+// Response creates the response for a secret issued from the named
+// role. The role name is added to the internal data for renewal, and
+// the lease uses the role's TTLs if it implements LeaseRole.
+func (l *LeaseSecret) Response(roleName string, role Entry, data, internalData map[string]interface{}) *logical.Response {
+	internal := make(map[string]interface{}, len(internalData)+1)
+	for k, v := range internalData {
+		internal[k] = v
+	}
+	internal[RoleInternalDataKey] = roleName
+
+	resp := l.Secret().Response(data, internal)
+	setLeaseTTLs(resp.Secret, role)
+
+	return resp
+}
+
+// renew extends a lease with the TTLs of the role it was issued from.
+func (l *LeaseSecret) renew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleRaw, ok := req.Secret.InternalData[RoleInternalDataKey]
+	if !ok {
+		return nil, errors.New("secret is missing role internal data")
+	}
+
+	roleName, ok := roleRaw.(string)
+	if !ok {
+		return nil, errors.New("invalid value for role in secret internal data")
+	}
+
+	role, err := l.Roles.Get(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %w", err)
+	}
+
+	if role == nil {
+		return nil, errors.New("error retrieving role: role is nil")
+	}
+
+	resp := &logical.Response{Secret: req.Secret}
+	setLeaseTTLs(resp.Secret, role)
+
+	return resp, nil
+}
+
+func setLeaseTTLs(secret *logical.Secret, role Entry) {
+	leaseRole, ok := role.(LeaseRole)
+	if !ok {
+		return
+	}
+
+	ttl, maxTTL := leaseRole.LeaseTTLs()
+	if ttl > 0 {
+		secret.TTL = ttl
+	}
+	if maxTTL > 0 {
+		secret.MaxTTL = maxTTL
+	}
+}
@@ -0,0 +1,44 @@
+package framework
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLeaseSecret checks that leases take the TTLs of their
+// role when issued and renewed, and fail to renew once the
+// role is deleted.
+func TestLeaseSecret(t *testing.T) {
+	ctx := context.Background()
+	s := new(logical.InmemStorage)
+	r := &Roles{New: newTestEntry}
+	l := &LeaseSecret{Type: "test_secret", Roles: r}
+
+	role := &testEntry{Value: "a", TTL: time.Minute}
+	require.NoError(t, r.Put(ctx, s, "a", role))
+
+	resp := l.Response("a", role, map[string]interface{}{"value": "a"}, map[string]interface{}{"secret": "s"})
+	require.Equal(t, time.Minute, resp.Secret.TTL)
+	require.Equal(t, "a", resp.Secret.InternalData[RoleInternalDataKey])
+	require.Equal(t, "s", resp.Secret.InternalData["secret"])
+	require.Equal(t, "test_secret", resp.Secret.InternalData["secret_type"])
+
+	role.TTL = time.Hour
+	require.NoError(t, r.Put(ctx, s, "a", role))
+
+	renewed, err := l.Secret().Renew(ctx, &logical.Request{Storage: s, Secret: resp.Secret}, nil)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, renewed.Secret.TTL)
+
+	require.NoError(t, s.Delete(ctx, "role/a"))
+	_, err = l.Secret().Renew(ctx, &logical.Request{Storage: s, Secret: resp.Secret}, nil)
+	require.Error(t, err)
+
+	resp.Secret.InternalData[RoleInternalDataKey] = 1
+	_, err = l.Secret().Renew(ctx, &logical.Request{Storage: s, Secret: resp.Secret}, nil)
+	require.Error(t, err)
+}
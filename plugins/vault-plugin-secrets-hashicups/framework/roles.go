@@ -0,0 +1,133 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultRolePrefix is the storage prefix used when Roles.Prefix is empty.
+	DefaultRolePrefix = "role/"
+
+	// RoleNameField is the path field holding the role name.
+	RoleNameField = "name"
+)
+
+// Roles stores named roles under a common prefix
+// and provides the handlers for their paths.
+type Roles struct {
+	// Prefix is the storage prefix of the roles.
+	// It defaults to DefaultRolePrefix.
+	Prefix string
+
+	// New returns an empty role.
+	New func() Entry
+
+	// Encode and Decode replace plain JSON encoding when set.
+	Encode EncodeFunc
+	Decode DecodeFunc
+}
+
+func (r *Roles) prefix() string {
+	if r.Prefix == "" {
+		return DefaultRolePrefix
+	}
+	return r.Prefix
+}
+
+func (r *Roles) store() store {
+	return store{new: r.New, encode: r.Encode, decode: r.Decode}
+}
+
+// Get returns the named role, or nil if it does not exist.
+func (r *Roles) Get(ctx context.Context, s logical.Storage, name string) (Entry, error) {
+	if name == "" {
+		return nil, errors.New("missing role name")
+	}
+
+	return r.store().get(ctx, s, r.prefix()+name)
+}
+
+// Put stores the named role.
+func (r *Roles) Put(ctx context.Context, s logical.Storage, name string, e Entry) error {
+	if name == "" {
+		return errors.New("missing role name")
+	}
+
+	return r.store().put(ctx, s, r.prefix()+name, e)
+}
+
+// List returns the names of every role.
+func (r *Roles) List(ctx context.Context, s logical.Storage) ([]string, error) {
+	return s.List(ctx, r.prefix())
+}
+
+// HandleList lists the names of every role.
+func (r *Roles) HandleList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := r.List(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+// HandleRead returns the non-sensitive fields of the role named in the path.
+func (r *Roles) HandleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := r.Get(ctx, req.Storage, d.Get(RoleNameField).(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: role.ResponseData(),
+	}, nil
+}
+
+// HandleWrite creates or updates the role named in the path. Required
+// fields are enforced whenever the role does not exist yet, since Vault
+// dispatches writes to paths without an existence check as updates.
+func (r *Roles) HandleWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name, ok := d.GetOk(RoleNameField)
+	if !ok {
+		return logical.ErrorResponse("missing role name"), nil
+	}
+
+	role, err := r.Get(ctx, req.Storage, name.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	create := role == nil
+	if create {
+		role = r.New()
+	}
+
+	if err := role.Update(d, create); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := r.Put(ctx, req.Storage, name.(string), role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// HandleDelete removes the role named in the path.
+func (r *Roles) HandleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	err := req.Storage.Delete(ctx, r.prefix()+d.Get(RoleNameField).(string))
+	if err != nil {
+		return nil, fmt.Errorf("error deleting role: %w", err)
+	}
+
+	return nil, nil
+}
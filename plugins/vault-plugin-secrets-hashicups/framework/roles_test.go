@@ -0,0 +1,83 @@
+package framework
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoles checks the role handlers, including
+// a custom storage prefix.
+func TestRoles(t *testing.T) {
+	s := new(logical.InmemStorage)
+	r := &Roles{
+		Prefix: "roles/",
+		New:    newTestEntry,
+	}
+
+	t.Run("Create Without Required Field", func(t *testing.T) {
+		// writes without an existence check arrive as updates
+		resp, err := testRequest(t, r.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{
+			RoleNameField: "a",
+		})
+		require.NoError(t, err)
+		require.True(t, resp.IsError())
+	})
+
+	t.Run("Create Roles", func(t *testing.T) {
+		for _, name := range []string{"a", "B"} {
+			resp, err := testRequest(t, r.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{
+				RoleNameField: name,
+				"value":       name,
+			})
+			require.NoError(t, err)
+			require.Nil(t, resp)
+		}
+
+		resp, err := testRequest(t, r.HandleList, s, logical.ListOperation, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, resp.Data["keys"])
+
+		entry, err := s.Get(context.Background(), "roles/a")
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+	})
+
+	t.Run("Update Role", func(t *testing.T) {
+		_, err := testRequest(t, r.HandleWrite, s, logical.UpdateOperation, map[string]interface{}{
+			RoleNameField: "a",
+			"ttl":         60,
+		})
+		require.NoError(t, err)
+
+		resp, err := testRequest(t, r.HandleRead, s, logical.ReadOperation, map[string]interface{}{
+			RoleNameField: "a",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "a", resp.Data["value"])
+		require.Equal(t, int64(60), resp.Data["ttl"])
+	})
+
+	t.Run("Delete Role", func(t *testing.T) {
+		_, err := testRequest(t, r.HandleDelete, s, logical.DeleteOperation, map[string]interface{}{
+			RoleNameField: "a",
+		})
+		require.NoError(t, err)
+
+		resp, err := testRequest(t, r.HandleRead, s, logical.ReadOperation, map[string]interface{}{
+			RoleNameField: "a",
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+	})
+
+	t.Run("Missing Role Name", func(t *testing.T) {
+		_, err := r.Get(context.Background(), s, "")
+		require.Error(t, err)
+
+		err = r.Put(context.Background(), s, "", new(testEntry))
+		require.Error(t, err)
+	})
+}
@@ -2,10 +2,10 @@ package secretsengine
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -26,9 +26,10 @@ type myToken struct {
 	Token string `json:"token"`
 }
 
-// hashiCupsToken defines a secret to store for a given role and how it should be revoked or renewed.
-func (b *myBackend) myToken() *framework.Secret {
-	return &framework.Secret{
+// myToken defines a secret to store for a given role and how it should be revoked.
+// Leases are renewed by the shared framework package with the TTLs of the role.
+func (b *myBackend) myToken() *hcframework.LeaseSecret {
+	return &hcframework.LeaseSecret{
 		Type: myTokenType,
 		Fields: map[string]*framework.FieldSchema{
 			"token": {
@@ -36,8 +37,8 @@ func (b *myBackend) myToken() *framework.Secret {
 				Description: "My Token",
 			},
 		},
+		Roles:  b.roles,
 		Revoke: b.tokenRevoke,
-		Renew:  b.tokenRenew,
 	}
 }
 
@@ -103,37 +104,3 @@ func createToken(
 		Token:    response.Token,
 	}, nil
 }
-
-// Verify that a role exists in the secrets engine backend before HashiCups creates a token. 
-// You also pass the secrets object as a response and reset the time to live (TTL) and maximum TTL for the role.
-func (b *myBackend) tokenRenew(
-	ctx context.Context,
-	req *logical.Request,
-	d *framework.FieldData) (*logical.Response, error) {
-
-	roleRaw, ok := req.Secret.InternalData["role"]
-	if !ok {
-		return nil, fmt.Errorf("secret is missing role internal data")
-	}
-
-	role := roleRaw.(string)
-	roleEntry, err := b.getRole(ctx, req.Storage, role)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving role: %w", err)
-	}
-
-	if roleEntry == nil {
-		return nil, errors.New("error retrieving role: role is nil")
-	}
-
-	resp := &logical.Response{Secret: req.Secret}
-
-	if roleEntry.TTL > 0 {
-		resp.Secret.TTL = roleEntry.TTL
-	}
-	if roleEntry.MaxTTL > 0 {
-		resp.Secret.MaxTTL = roleEntry.MaxTTL
-	}
-
-	return resp, nil
-}
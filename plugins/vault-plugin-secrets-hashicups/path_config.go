@@ -3,8 +3,9 @@ package secretsengine
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net/http"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -56,142 +57,120 @@ func pathConfig(b *myBackend) *framework.Path {
 			},
 		},
 		// Read, write, update and delete operations are supported.
+		// The handlers come from the shared framework package and
+		// call the Update and ResponseData methods of myConfig.
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
-				Callback: b.pathConfigRead,
+				Callback:    b.config.HandleRead,
+				Summary:     "Read the My backend configuration.",
+				Description: "Returns the username and URL used to access the My Product API. The password is never returned.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Example: &logical.Response{
+							Data: map[string]interface{}{
+								"username": "vault-plugin-testing",
+								"url":      "http://localhost:19090",
+							},
+						},
+					}},
+				},
 			},
 			logical.CreateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+				Callback:    b.config.HandleWrite,
+				Summary:     "Configure the My backend.",
+				Description: "Stores the username, password and URL used to access the My Product API.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration stored",
+					}},
+				},
 			},
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+				Callback:    b.config.HandleWrite,
+				Summary:     "Update the My backend configuration.",
+				Description: "Updates any of the username, password and URL used to access the My Product API.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration updated",
+					}},
+				},
 			},
 			logical.DeleteOperation: &framework.PathOperation{
-				Callback: b.pathConfigDelete,
+				Callback:    b.config.HandleDelete,
+				Summary:     "Delete the My backend configuration.",
+				Description: "Removes the stored configuration and resets the My client.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration deleted",
+					}},
+				},
 			},
 		},
-		ExistenceCheck:  b.pathConfigExistenceCheck,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Navigation: true,
+			ItemType:   "Configuration",
+			Action:     "Configure",
+		},
+		ExistenceCheck:  b.config.ExistenceCheck,
 		HelpSynopsis:    pathConfigHelpSynopsis,
 		HelpDescription: pathConfigHelpDescription,
 	}
 }
 
-// pathConfigExistenceCheck verifies if the configuration exists.
-func (b *myBackend) pathConfigExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
-	out, err := req.Storage.Get(ctx, req.Path)
-	if err != nil {
-		return false, fmt.Errorf("existence check failed: %w", err)
-	}
-
-	return out != nil, nil
-}
-
-func getConfig(ctx context.Context, s logical.Storage) (*myConfig, error) {
-	entry, err := s.Get(ctx, configStoragePath)
-	if err != nil {
-		return nil, err
+// Update applies the fields of a write request to the configuration.
+// Verify you passed a username, URL, and password for the target API
+// to the configuration using the GetOk method.
+// You use GetOk to enforce required attributes during a CreateOperation.
+func (c *myConfig) Update(data *framework.FieldData, create bool) error {
+	if username, ok := data.GetOk("username"); ok {
+		c.Username = username.(string)
+	} else if !ok && create {
+		return errors.New("missing username in configuration")
 	}
 
-	if entry == nil {
-		return nil, nil
+	if url, ok := data.GetOk("url"); ok {
+		c.URL = url.(string)
+	} else if !ok && create {
+		return errors.New("missing url in configuration")
 	}
 
-	config := new(myConfig)
-	if err := entry.DecodeJSON(&config); err != nil {
-		return nil, fmt.Errorf("error reading root configuration: %w", err)
+	if password, ok := data.GetOk("password"); ok {
+		c.Password = password.(string)
+	} else if !ok && create {
+		return errors.New("missing password in configuration")
 	}
 
-	// return the config, we are done
-	return config, nil
+	return nil
 }
 
-// The method reads the configuration and outputs non-sensitive fields,
+// ResponseData outputs the non-sensitive fields of the configuration,
 // specifically the My username and URL.
-func (b *myBackend) pathConfigRead(
-	ctx context.Context,
-	req *logical.Request,
-	data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
+func (c *myConfig) ResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"username": c.Username,
+		"url":      c.URL,
 	}
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"username": config.Username,
-			"url":      config.URL,
-		},
-	}, nil
 }
 
-// The method reads the configuration and outputs non-sensitive fields,
-// specifically the My username and URL.
-func (b *myBackend) pathConfigDelete(
-	ctx context.Context,
-	req *logical.Request,
-	data *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, configStoragePath)
-	if err == nil {
-		b.reset()
+// newConfigStore stores the configuration under `config`.
+// Writing or deleting it resets the client so Vault
+// picks up the new configuration.
+func newConfigStore(b *myBackend) *hcframework.Config {
+	return &hcframework.Config{
+		Key:      configStoragePath,
+		New:      func() hcframework.Entry { return new(myConfig) },
+		OnChange: b.reset,
 	}
-	return nil, err
 }
 
-// The method accounts for specific logic, including:
-// If the configuration does not exist and you need to update it,
-// the handler throws an error.
-// Verify you passed a username, URL, and password for the target API
-// to the configuration using the GetOk method.
-// You use GetOk to enforce required attributes during a CreateOperation.
-// Write the new or updated configuration using Storage.Put.
-// Reset the configuration so Vault picks up the new configuration.
-func (b *myBackend) pathConfigWrite(
-	ctx context.Context,
-	req *logical.Request,
-	data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-
-	createOperation := (req.Operation == logical.CreateOperation)
-
-	if config == nil {
-		if !createOperation {
-			return nil, errors.New("config not found during update operation")
-		}
-		config = new(myConfig)
-	}
-
-	if username, ok := data.GetOk("username"); ok {
-		config.Username = username.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing username in configuration")
-	}
-
-	if url, ok := data.GetOk("url"); ok {
-		config.URL = url.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing url in configuration")
-	}
-
-	if password, ok := data.GetOk("password"); ok {
-		config.Password = password.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing password in configuration")
-	}
-
-	entry, err := logical.StorageEntryJSON(configStoragePath, config)
-	if err != nil {
+// getConfig reads the configuration, returning nil if it is not set.
+func (b *myBackend) getConfig(ctx context.Context, s logical.Storage) (*myConfig, error) {
+	config, err := b.config.Get(ctx, s)
+	if err != nil || config == nil {
 		return nil, err
 	}
-
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, err
-	}
-
-	b.reset()
-
-	return nil, nil
+	return config.(*myConfig), nil
 }
 
 // pathConfigHelpSynopsis summarizes the help text for the configuration
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -21,17 +22,52 @@ func pathCredentials(b *myBackend) *framework.Path {
 				Type:        framework.TypeLowerCaseString,
 				Description: "Name of the role",
 				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Role Name",
+				},
 			},
 		},
-		Callbacks:       map[logical.Operation]framework.OperationFunc{
-			logical.ReadOperation: b.pathCredentialsRead,
-			logical.UpdateOperation: b.pathCredentialsRead,
+		// Each operation has a summary, a description and its
+		// responses, which Vault includes in its OpenAPI output.
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsRead,
+				Summary:     "Generate a My token.",
+				Description: "Signs in to the My API as the role's user and returns a leased token.",
+				Responses:   pathCredentialsResponses,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsRead,
+				Summary:     "Generate a My token.",
+				Description: "Signs in to the My API as the role's user and returns a leased token.",
+				Responses:   pathCredentialsResponses,
+			},
+		},
+		DisplayAttrs: &framework.DisplayAttributes{
+			ItemType: "Credential",
+			Action:   "Generate",
 		},
 		HelpSynopsis:    pathCredentialsHelpSyn,
 		HelpDescription: pathCredentialsHelpDesc,
 	}
 }
 
+// pathCredentialsResponses documents the token returned
+// by the `/creds` endpoint.
+var pathCredentialsResponses = map[int][]framework.Response{
+	http.StatusOK: {{
+		Description: "OK",
+		Example: &logical.Response{
+			Data: map[string]interface{}{
+				"token":    "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9",
+				"token_id": "4f0c5c4e-2b4c-4d6a-9d5e-6d3b1c0f7a21",
+				"user_id":  1,
+				"username": "vault-plugin-testing",
+			},
+		},
+	}},
+}
+
 // It creates the token based on the username in the role entry passed to the creds endpoint
 func (b *myBackend) createToken(
 	ctx context.Context,
@@ -58,10 +94,11 @@ func (b *myBackend) createToken(
 }
 
 // The method creates the My token and maps it to a response for the secrets engine backend to return.
-// It also sets the time to live (TTL) and maximum TTL for the secret.
+// The lease records the role name and uses the time to live (TTL) and maximum TTL of the role.
 func (b *myBackend) createUserCreds(
 	ctx context.Context,
 	req *logical.Request,
+	roleName string,
 	role *myRoleEntry) (*logical.Response, error) {
 
 	token, err := b.createToken(ctx, req.Storage, role)
@@ -69,25 +106,14 @@ func (b *myBackend) createUserCreds(
 		return nil, err
 	}
 
-	resp := b.Secret(myTokenType).Response(map[string]interface{}{
+	return b.tokens.Response(roleName, role, map[string]interface{}{
 		"token":    token.Token,
 		"token_id": token.TokenID,
 		"user_id":  token.UserID,
 		"username": token.Username,
 	}, map[string]interface{}{
 		"token": token.Token,
-		"role":  role.Username,
-	})
-
-	if role.TTL > 0 {
-		resp.Secret.TTL = role.TTL
-	}
-
-	if role.MaxTTL > 0 {
-		resp.Secret.MaxTTL = role.MaxTTL
-	}
-
-	return resp, nil
+	}), nil
 }
 
 // The method verifies the role exists for the secrets engine and creates a new HashiCups token based on the role entry.
@@ -107,7 +133,7 @@ func (b *myBackend) pathCredentialsRead(
 		return nil, errors.New("error retrieving role: role is nil")
 	}
 
-	return b.createUserCreds(ctx, req, roleEntry)
+	return b.createUserCreds(ctx, req, roleName, roleEntry)
 }
 
 const pathCredentialsHelpSyn = `
@@ -2,9 +2,11 @@ package secretsengine
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net/http"
 	"time"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -21,8 +23,8 @@ type myRoleEntry struct {
 	MaxTTL   time.Duration `json:"max_ttl"`
 }
 
-// toResponseData returns response data for a role
-func (r *myRoleEntry) toResponseData() map[string]interface{} {
+// ResponseData returns response data for a role
+func (r *myRoleEntry) ResponseData() map[string]interface{} {
 	respData := map[string]interface{}{
 		"ttl":      r.TTL.Seconds(),
 		"max_ttl":  r.MaxTTL.Seconds(),
@@ -62,181 +64,134 @@ func pathRole(b *myBackend) []*framework.Path {
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
-					Callback: b.pathRolesRead,
-				},
-				logical.UpdateOperation: &framework.PathOperation{
-					Callback: b.pathRolesWrite,
+					Callback:    b.roles.HandleRead,
+					Summary:     "Read a My role.",
+					Description: "Returns the username and lease settings of the role.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example: &logical.Response{
+								Data: map[string]interface{}{
+									"username": "vault-plugin-testing",
+									"ttl":      120,
+									"max_ttl":  3600,
+								},
+							},
+						}},
+					},
 				},
 				logical.CreateOperation: &framework.PathOperation{
-					Callback: b.pathRolesWrite,
+					Callback:    b.roles.HandleWrite,
+					Summary:     "Create a My role.",
+					Description: "Creates a role that generates tokens for the given My username.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role created",
+						}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:    b.roles.HandleWrite,
+					Summary:     "Update a My role.",
+					Description: "Updates the username or lease settings of an existing role.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role updated",
+						}},
+					},
 				},
 				logical.DeleteOperation: &framework.PathOperation{
-					Callback: b.pathRolesDelete,
+					Callback:    b.roles.HandleDelete,
+					Summary:     "Delete a My role.",
+					Description: "Removes the role. Tokens already issued from it are not revoked.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role deleted",
+						}},
+					},
 				},
 			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				ItemType: "Role",
+			},
 			HelpSynopsis:    pathRoleHelpSynopsis,
 			HelpDescription: pathRoleHelpDescription,
 		},
 		{
-			Pattern:         "role/?$",
-			Operations:      map[logical.Operation]framework.OperationHandler{
+			Pattern: "role/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ListOperation: &framework.PathOperation{
-					Callback: b.pathRolesList,
+					Callback:    b.roles.HandleList,
+					Summary:     "List My roles.",
+					Description: "Returns the names of all roles configured in the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example:     logical.ListResponse([]string{"my-role"}),
+						}},
+					},
 				},
 			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				Navigation: true,
+				ItemType:   "Role",
+			},
 			HelpSynopsis:    pathRoleListHelpSynopsis,
 			HelpDescription: pathRoleListHelpDescription,
 		},
 	}
 }
 
-// Retrieves the role from the secrets engine backend and decodes it to the role entry object.
-func (b *myBackend) getRole(
-	ctx context.Context,
-	s logical.Storage,
-	name string) (*myRoleEntry, error) {
-	if name == "" {
-		return nil, fmt.Errorf("missing role name")
-	}
-
-	entry, err := s.Get(ctx, "role/"+name)
-	if err != nil {
-		return nil, err
-	}
-
-	if entry == nil {
-		return nil, nil
-	}
-
-	var role myRoleEntry
-
-	if err := entry.DecodeJSON(&role); err != nil {
-		return nil, err
-	}
-	return &role, nil
-}
-
-// Reads the role and outputs non-sensitive fields using the toResponseData method.
-func (b *myBackend) pathRolesRead(
-	ctx context.Context,
-	req *logical.Request,
-	d *framework.FieldData) (*logical.Response, error) {
-	entry, err := b.getRole(ctx, req.Storage, d.Get("name").(string))
-	if err != nil {
-		return nil, err
-	}
-
-	if entry == nil {
-		return nil, nil
-	}
-
-	return &logical.Response{
-		Data: entry.toResponseData(),
-	}, nil
-}
-
-// Write the role to the secrets engine backend.
-func setRole(
-	ctx context.Context,
-	s logical.Storage,
-	name string,
-	roleEntry *myRoleEntry) error {
-	entry, err := logical.StorageEntryJSON("role/"+name, roleEntry)
-	if err != nil {
-		return err
-	}
-
-	if entry == nil {
-		return fmt.Errorf("failed to create storage entry for role")
-	}
-
-	if err := s.Put(ctx, entry); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Updates the role if any fields like username, TTL, or max TTL changes
-// and creates the roles if it does not already exist.
-// The new or updated role gets written to storage.
-func (b *myBackend) pathRolesWrite(
-	ctx context.Context,
-	req *logical.Request,
-	d *framework.FieldData) (*logical.Response, error) {
-	name, ok := d.GetOk("name")
-	if !ok {
-		return logical.ErrorResponse("missing role name"), nil
-	}
-
-	roleEntry, err := b.getRole(ctx, req.Storage, name.(string))
-	if err != nil {
-		return nil, err
-	}
-
-	if roleEntry == nil {
-		roleEntry = new(myRoleEntry)
-	}
-
-	createOperation := (req.Operation == logical.CreateOperation)
-
+// Update changes the role if any fields like username, TTL, or max TTL
+// are set, and enforces the required fields when the role is created.
+func (r *myRoleEntry) Update(d *framework.FieldData, create bool) error {
 	if username, ok := d.GetOk("username"); ok {
-		roleEntry.Username = username.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing username in role")
+		r.Username = username.(string)
+	} else if !ok && create {
+		return errors.New("missing username in role")
 	}
 
 	if ttlRaw, ok := d.GetOk("ttl"); ok {
-		roleEntry.TTL = time.Duration(ttlRaw.(int)) * time.Second
-	} else if createOperation {
-		roleEntry.TTL = time.Duration(d.Get("ttl").(int)) * time.Second
+		r.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	} else if create {
+		r.TTL = time.Duration(d.Get("ttl").(int)) * time.Second
 	}
 
 	if maxTTLRaw, ok := d.GetOk("max_ttl"); ok {
-		roleEntry.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
-	} else if createOperation {
-		roleEntry.MaxTTL = time.Duration(d.Get("max_ttl").(int)) * time.Second
+		r.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	} else if create {
+		r.MaxTTL = time.Duration(d.Get("max_ttl").(int)) * time.Second
 	}
 
-	if roleEntry.MaxTTL != 0 && roleEntry.TTL > roleEntry.MaxTTL {
-		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	if r.MaxTTL != 0 && r.TTL > r.MaxTTL {
+		return errors.New("ttl cannot be greater than max_ttl")
 	}
 
-	if err := setRole(ctx, req.Storage, name.(string), roleEntry); err != nil {
-		return nil, err
-	}
+	return nil
+}
 
-	return nil, nil
+// LeaseTTLs returns the TTLs of tokens issued from the role
+func (r *myRoleEntry) LeaseTTLs() (time.Duration, time.Duration) {
+	return r.TTL, r.MaxTTL
 }
 
-// The method deletes the role from the secrets engine backend.
-func (b *myBackend) pathRolesDelete(
-	ctx context.Context,
-	req *logical.Request,
-	d *framework.FieldData) (*logical.Response, error) {
-	name, ok := d.GetOk("name")
-	if !ok {
-		return logical.ErrorResponse("missing role name"), nil
+// newRoleStore stores roles under `role/`.
+func newRoleStore() *hcframework.Roles {
+	return &hcframework.Roles{
+		New: func() hcframework.Entry { return new(myRoleEntry) },
 	}
-	// delete the role
-	err := req.Storage.Delete(ctx, "role/"+name.(string))
-	if err != nil {
-		return nil, fmt.Errorf("error deleting hashiCups role: %w", err)
-	}
-	return nil, nil
 }
 
-// The method lists all the roles stored in the secrets engine backend
-// and lists the responses using logical.ListResponses
-func (b *myBackend) pathRolesList(
+// Retrieves the role from the secrets engine backend and decodes it to the role entry object.
+func (b *myBackend) getRole(
 	ctx context.Context,
-	req *logical.Request,
-	d *framework.FieldData) (*logical.Response, error) {
-	entries, err := req.Storage.List(ctx, "role/")
-	if err != nil {
+	s logical.Storage,
+	name string) (*myRoleEntry, error) {
+	role, err := b.roles.Get(ctx, s, name)
+	if err != nil || role == nil {
 		return nil, err
 	}
-	return logical.ListResponse(entries), nil
+	return role.(*myRoleEntry), nil
 }
 
 const (
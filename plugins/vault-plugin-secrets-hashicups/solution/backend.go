@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -24,13 +25,32 @@ type myBackend struct {
 	*framework.Backend
 	lock   sync.RWMutex
 	client *hashiCupsClient
+	status clientStatus
+
+	// retired caches clients for retired connections, and
+	// connLock serializes updates to connection entries.
+	retired  map[string]*hashiCupsClient
+	connLock sync.Mutex
+
+	// batchLock serializes revocations of batch tokens.
+	batchLock sync.Mutex
+
+	config *hcframework.Config
+	roles  *hcframework.Roles
+	tokens *hcframework.LeaseSecret
 }
 
 // backend defines the target API backend
 // for Vault. It must include each path
 // and the secrets it will store.
 func backend() *myBackend {
-	var b = myBackend{}
+	var b = myBackend{
+		retired: make(map[string]*hashiCupsClient),
+	}
+
+	b.config = newConfigStore(&b)
+	b.roles = newRoleStore()
+	b.tokens = b.hashiCupsToken()
 
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(backendHelp),
@@ -39,20 +59,26 @@ func backend() *myBackend {
 			SealWrapStorage: []string{
 				"config",
 				"role/*",
+				connectionStoragePrefix + "*",
+				batchTokenStoragePrefix + "*",
 			},
 		},
 		Paths: framework.PathAppend(
 			pathRole(&b),
+			pathExport(&b),
 			[]*framework.Path{
 				pathConfig(&b),
 				pathCredentials(&b),
+				pathCredentialsBatch(&b),
+				pathCredentialsBatchToken(&b),
 			},
 		),
 		Secrets: []*framework.Secret{
-			b.hashiCupsToken(),
+			b.tokens.Secret(),
 		},
-		BackendType: logical.TypeLogical,
-		Invalidate:  b.invalidate,
+		BackendType:    logical.TypeLogical,
+		Invalidate:     b.invalidate,
+		InitializeFunc: b.initialize,
 	}
 	return &b
 }
@@ -63,16 +89,28 @@ func (b *myBackend) reset() {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 	b.client = nil
+	b.status.reset()
 }
 
 // invalidate clears an existing client configuration in
 // the backend
 func (b *myBackend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
+	switch {
+	case key == "config":
 		b.reset()
+	case strings.HasPrefix(key, connectionStoragePrefix):
+		b.dropRetiredClient(strings.TrimPrefix(key, connectionStoragePrefix))
 	}
 }
 
+// clientCached reports whether a client is cached
+// for the target API
+func (b *myBackend) clientCached() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.client != nil
+}
+
 // getClient locks the backend as it configures and creates a
 // a new client for the target API
 func (b *myBackend) getClient(ctx context.Context, s logical.Storage) (*hashiCupsClient, error) {
@@ -88,7 +126,7 @@ func (b *myBackend) getClient(ctx context.Context, s logical.Storage) (*hashiCup
 	b.lock.Lock()
 	unlockFunc = b.lock.Unlock
 
-	config, err := getConfig(ctx, s)
+	config, err := b.getConfig(ctx, s)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +135,9 @@ func (b *myBackend) getClient(ctx context.Context, s logical.Storage) (*hashiCup
 		config = new(hashiCupsConfig)
 	}
 
+	// creating a client signs in to HashiCups
 	b.client, err = newClient(config)
+	b.status.record(err)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,126 @@
+package secretsengine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// The benchmarks run against the fake HashiCups API from
+// internal/fakehashicups, served on a local port, so they measure
+// the engine and its locking rather than a real HashiCups instance.
+// See the Benchmarks section of the README for a baseline.
+
+// benchmarkBackend returns a backend configured against
+// the fake HashiCups API, with one role for each name.
+func benchmarkBackend(b *testing.B, roles ...string) (*myBackend, logical.Storage) {
+	b.Helper()
+
+	backend, s := getTestBackend(b)
+	server := newTestHashiCupsServer(b)
+
+	if err := backend.config.Put(context.Background(), s, &hashiCupsConfig{
+		Username: username,
+		Password: password,
+		URL:      server.URL,
+	}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range roles {
+		if err := backend.roles.Put(context.Background(), s, name, &hashiCupsRoleEntry{
+			Username: username,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return backend, s
+}
+
+// BenchmarkCredentialsRead issues tokens for a role in parallel,
+// which reads the role, gets the client, signs in to HashiCups
+// and counts the lease against its connection.
+func BenchmarkCredentialsRead(b *testing.B) {
+	backend, s := benchmarkBackend(b, roleName)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := backend.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/" + roleName,
+				Storage:   s,
+			})
+			if err != nil || resp.IsError() {
+				b.Errorf("err: %v, resp: %#v", err, resp)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkGetClient gets the HashiCups client in parallel.
+// Every cache miss takes the write lock and signs in, so the
+// sub-benchmarks reset the client at different rates to show
+// the cost of contention after a configuration change.
+func BenchmarkGetClient(b *testing.B) {
+	for _, resetEvery := range []int{0, 1000, 100, 10} {
+		name := "Cached"
+		if resetEvery > 0 {
+			name = fmt.Sprintf("ResetEvery%d", resetEvery)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			backend, s := benchmarkBackend(b)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 1; pb.Next(); i++ {
+					if resetEvery > 0 && i%resetEvery == 0 {
+						backend.reset()
+					}
+
+					if _, err := backend.getClient(context.Background(), s); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRoleLookup reads roles from storage in parallel, as
+// every credential request does, with a few and many roles stored.
+func BenchmarkRoleLookup(b *testing.B) {
+	for _, count := range []int{1, 1000} {
+		b.Run(fmt.Sprintf("Roles%d", count), func(b *testing.B) {
+			names := make([]string, count)
+			for i := range names {
+				names[i] = fmt.Sprintf("role-%d", i)
+			}
+
+			backend, s := benchmarkBackend(b, names...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					role, err := backend.getRole(context.Background(), s, names[i%count])
+					if err != nil || role == nil {
+						b.Errorf("err: %v, role: %v", err, role)
+						return
+					}
+				}
+			})
+		})
+	}
+}
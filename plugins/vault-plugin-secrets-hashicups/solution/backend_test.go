@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/solution/internal/fakehashicups"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/require"
 )
@@ -140,3 +141,17 @@ func (e *testEnv) CleanupUserTokens(t *testing.T) {
 		}
 	}
 }
+
+// newTestHashiCupsServer starts a fake HashiCups API
+// that is stopped when the test completes.
+func newTestHashiCupsServer(tb testing.TB) *fakehashicups.Server {
+	tb.Helper()
+
+	server, err := fakehashicups.Start(hclog.NewNullLogger())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { server.Close() })
+
+	return server
+}
@@ -0,0 +1,121 @@
+package secretsengine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// batchTokenStoragePrefix holds one entry per token issued
+	// by `/creds/<role>/batch` that has not been revoked yet.
+	batchTokenStoragePrefix = "batch-tokens/"
+
+	// batchTokenIDsInternalDataKey is the secret internal data key
+	// holding the IDs of the tokens issued under a batch lease.
+	batchTokenIDsInternalDataKey = "token_ids"
+)
+
+// hashiCupsBatchToken is a token issued by a batch request. Vault
+// attaches a single lease to a response, so each token of a batch
+// is stored to be revoked on its own, before the batch lease is.
+type hashiCupsBatchToken struct {
+	Role         string `json:"role"`
+	Token        string `json:"token"`
+	ConnectionID string `json:"connection_id"`
+}
+
+func putBatchToken(ctx context.Context, s logical.Storage, id string, token *hashiCupsBatchToken) error {
+	entry, err := logical.StorageEntryJSON(batchTokenStoragePrefix+id, token)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// getBatchToken returns the stored token, or nil if it has
+// already been revoked, or if role is set and the token
+// was issued from another role.
+func getBatchToken(ctx context.Context, s logical.Storage, role, id string) (*hashiCupsBatchToken, error) {
+	entry, err := s.Get(ctx, batchTokenStoragePrefix+id)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	token := new(hashiCupsBatchToken)
+	if err := entry.DecodeJSON(token); err != nil {
+		return nil, fmt.Errorf("error reading batch token %q: %w", id, err)
+	}
+
+	if role != "" && token.Role != role {
+		return nil, nil
+	}
+	return token, nil
+}
+
+// revokeBatchToken signs a token of a batch out of the connection it
+// was issued against and releases its lease. The stored token is only
+// deleted once both succeed, so a failed revocation can be retried,
+// and the lock keeps two revocations from releasing the lease twice.
+// Revoking a token that has already been revoked does nothing.
+func (b *myBackend) revokeBatchToken(ctx context.Context, s logical.Storage, role, id string) error {
+	b.batchLock.Lock()
+	defer b.batchLock.Unlock()
+
+	token, err := getBatchToken(ctx, s, role, id)
+	if err != nil || token == nil {
+		return err
+	}
+
+	client, err := b.revocationClient(ctx, s, token.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("error getting client: %w", err)
+	}
+
+	if err := deleteToken(ctx, client, token.Token); err != nil {
+		return fmt.Errorf("error revoking user token: %w", err)
+	}
+
+	if err := b.leaseRevoked(ctx, s, token.ConnectionID); err != nil {
+		return fmt.Errorf("error updating connection: %w", err)
+	}
+
+	return s.Delete(ctx, batchTokenStoragePrefix+id)
+}
+
+// batchTokenIDs returns the token IDs stored in the internal data of
+// a secret issued by `/creds/<role>/batch`. Once the lease has been
+// persisted by Vault the list is decoded as []interface{}.
+func batchTokenIDs(internalData map[string]interface{}) ([]string, bool, error) {
+	idsRaw, ok := internalData[batchTokenIDsInternalDataKey]
+	if !ok {
+		return nil, false, nil
+	}
+
+	ids, err := stringList(idsRaw)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid value for %s in secret internal data", batchTokenIDsInternalDataKey)
+	}
+	return ids, true, nil
+}
+
+// stringList converts a list of strings from secret internal data.
+func stringList(raw interface{}) ([]string, error) {
+	switch list := raw.(type) {
+	case []string:
+		return list, nil
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, itemRaw := range list {
+			item, ok := itemRaw.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string, got %T", itemRaw)
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("expected a list, got %T", raw)
+	}
+}
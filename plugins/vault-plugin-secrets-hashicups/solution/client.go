@@ -2,6 +2,8 @@ package secretsengine
 
 import (
 	"errors"
+	"sync"
+	"time"
 
 	hashicups "github.com/hashicorp-demoapp/hashicups-client-go"
 )
@@ -10,6 +12,10 @@ import (
 // the client.
 type hashiCupsClient struct {
 	*hashicups.Client
+
+	// connectionID identifies the URL and user
+	// the client signs in to.
+	connectionID string
 }
 
 // newClient creates a new client to access HashiCups
@@ -35,5 +41,84 @@ func newClient(config *hashiCupsConfig) (*hashiCupsClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &hashiCupsClient{c}, nil
+	return &hashiCupsClient{c, connectionID(config)}, nil
+}
+
+const (
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+	healthUnknown   = "unknown"
+)
+
+// clientStatus records the outcome of the most recent
+// sign ins to HashiCups so the configuration can
+// report whether the mount is healthy.
+type clientStatus struct {
+	lock        sync.Mutex
+	lastSignIn  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// record stores the result of a sign in to HashiCups.
+func (s *clientStatus) record(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+
+	s.lastSignIn = time.Now()
+}
+
+// reset forgets any recorded sign ins, for example
+// after the configuration changes.
+func (s *clientStatus) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastSignIn = time.Time{}
+	s.lastError = ""
+	s.lastErrorAt = time.Time{}
+}
+
+// health computes the health state from the most recent
+// sign in result. The mount is healthy when the last
+// sign in succeeded and unknown until one is attempted.
+func (s *clientStatus) health() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case s.lastSignIn.IsZero() && s.lastErrorAt.IsZero():
+		return healthUnknown
+	case s.lastErrorAt.After(s.lastSignIn):
+		return healthUnhealthy
+	default:
+		return healthHealthy
+	}
+}
+
+// toResponseData returns the recorded status as response data.
+func (s *clientStatus) toResponseData() map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return map[string]interface{}{
+		"last_sign_in":    formatTime(s.lastSignIn),
+		"last_error":      s.lastError,
+		"last_error_time": formatTime(s.lastErrorAt),
+	}
+}
+
+// formatTime returns t in RFC 3339 format,
+// or an empty string if t is not set.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
 }
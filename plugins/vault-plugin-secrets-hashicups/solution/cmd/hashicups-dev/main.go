@@ -0,0 +1,94 @@
+// Command hashicups-dev serves the HashiCups secrets engine over a
+// Vault-style HTTP API, with in-memory storage and an embedded fake
+// HashiCups API, so that config, roles and creds can be exercised
+// with curl without running a Vault server.
+//
+//	$ go run ./solution/cmd/hashicups-dev
+//	$ curl -X PUT -d '{"username":"vault-plugin-testing"}' http://127.0.0.1:8200/v1/hashicups/role/test
+//	$ curl http://127.0.0.1:8200/v1/hashicups/creds/test
+//	$ curl -X PUT -d '{"lease_id":"..."}' http://127.0.0.1:8200/v1/sys/leases/revoke
+//
+// Nothing is persisted: every restart starts from an empty mount.
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	hashicups "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/solution"
+	"github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/solution/internal/fakehashicups"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	devUsername = "vault-plugin-testing"
+	devPassword = "Testing!123"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8200", "address to serve the Vault-style API on")
+	mount := flag.String("mount", "hashicups", "path the secrets engine is mounted at")
+	hashiCupsURL := flag.String("hashicups-url", "", "URL of a HashiCups API to use instead of the embedded fake; the config is then left for you to write")
+	flag.Parse()
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:  "hashicups-dev",
+		Level: hclog.Debug,
+	})
+
+	if err := run(logger, *addr, *mount, *hashiCupsURL); err != nil {
+		logger.Error("shutting down", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(logger hclog.Logger, addr, mount, hashiCupsURL string) error {
+	ctx := context.Background()
+
+	s, err := newMount(ctx, logger, mount)
+	if err != nil {
+		return err
+	}
+
+	if hashiCupsURL == "" {
+		fake, err := fakehashicups.Start(logger.Named("fake-hashicups"))
+		if err != nil {
+			return err
+		}
+		defer fake.Close()
+
+		if err := s.configure(ctx, fake.URL); err != nil {
+			return err
+		}
+		logger.Info("configured mount against the fake HashiCups API", "url", fake.URL, "username", devUsername)
+	}
+
+	logger.Info("serving HashiCups secrets engine", "addr", "http://"+addr, "mount", mount)
+	return http.ListenAndServe(addr, s)
+}
+
+// newMount creates the secrets engine with in-memory storage
+// and serves it at mount.
+func newMount(ctx context.Context, logger hclog.Logger, mount string) (*devServer, error) {
+	storage := new(logical.InmemStorage)
+	system := logical.TestSystemView()
+
+	b, err := hashicups.Factory(ctx, &logical.BackendConfig{
+		Logger:      logger.Named("backend"),
+		System:      system,
+		StorageView: storage,
+		Config:      map[string]string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}); err != nil {
+		return nil, err
+	}
+
+	return newDevServer(b, storage, system, mount, logger), nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// existenceChecker is implemented by framework backends, and
+// lets writes be sent as create or update operations as Vault
+// would.
+type existenceChecker interface {
+	HandleExistenceCheck(ctx context.Context, req *logical.Request) (checkFound bool, exists bool, err error)
+}
+
+// devServer translates Vault-style HTTP requests into
+// logical requests against a single mounted backend, and
+// keeps the leases it issues so they can be renewed and
+// revoked through `sys/leases`.
+type devServer struct {
+	backend logical.Backend
+	storage logical.Storage
+	system  logical.SystemView
+	mount   string
+	logger  hclog.Logger
+
+	lock   sync.Mutex
+	leases map[string]*logical.Secret
+}
+
+func newDevServer(b logical.Backend, s logical.Storage, system logical.SystemView, mount string, logger hclog.Logger) *devServer {
+	return &devServer{
+		backend: b,
+		storage: s,
+		system:  system,
+		mount:   strings.Trim(mount, "/") + "/",
+		logger:  logger,
+		leases:  make(map[string]*logical.Secret),
+	}
+}
+
+// response is the body of a successful response, in the
+// same shape as the Vault HTTP API.
+type response struct {
+	LeaseID       string                 `json:"lease_id"`
+	Renewable     bool                   `json:"renewable"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Warnings      []string               `json:"warnings"`
+}
+
+func (s *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		logical.RespondError(w, http.StatusNotFound, nil)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	op, err := operation(r)
+	if err != nil {
+		logical.RespondError(w, http.StatusMethodNotAllowed, err)
+		return
+	}
+
+	data, err := requestData(r)
+	if err != nil {
+		logical.RespondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.logger.Debug("request", "operation", op, "path", path)
+
+	switch {
+	case path == "sys/leases/revoke" && op == logical.UpdateOperation:
+		s.handleRevoke(w, r.Context(), data)
+	case path == "sys/leases/renew" && op == logical.UpdateOperation:
+		s.handleRenew(w, r.Context(), data)
+	case strings.HasPrefix(path, s.mount):
+		s.handleBackend(w, r.Context(), op, strings.TrimPrefix(path, s.mount), data)
+	default:
+		logical.RespondError(w, http.StatusNotFound, fmt.Errorf("no handler for route %q", path))
+	}
+}
+
+// operation maps the HTTP method to a logical operation.
+func operation(r *http.Request) (logical.Operation, error) {
+	switch r.Method {
+	case http.MethodGet:
+		if list, _ := parseutil.ParseBool(r.URL.Query().Get("list")); list {
+			return logical.ListOperation, nil
+		}
+		return logical.ReadOperation, nil
+	case "LIST":
+		return logical.ListOperation, nil
+	case http.MethodPut, http.MethodPost:
+		return logical.UpdateOperation, nil
+	case http.MethodDelete:
+		return logical.DeleteOperation, nil
+	default:
+		return "", fmt.Errorf("unsupported method %q", r.Method)
+	}
+}
+
+// requestData decodes the JSON body of a request, if any.
+func requestData(r *http.Request) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := jsonutil.DecodeJSONFromReader(r.Body, &data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse JSON input: %w", err)
+	}
+	return data, nil
+}
+
+// configure writes a configuration for the fake HashiCups API.
+func (s *devServer) configure(ctx context.Context, url string) error {
+	resp, err := s.backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config",
+		Storage:   s.storage,
+		Data: map[string]interface{}{
+			"username": devUsername,
+			"password": devPassword,
+			"url":      url,
+		},
+	})
+	if err == nil && resp.IsError() {
+		err = resp.Error()
+	}
+	return err
+}
+
+func (s *devServer) handleBackend(w http.ResponseWriter, ctx context.Context, op logical.Operation, path string, data map[string]interface{}) {
+	req := &logical.Request{
+		ID:         uuid.New().String(),
+		Operation:  op,
+		Path:       path,
+		Data:       data,
+		Storage:    s.storage,
+		MountPoint: s.mount,
+	}
+
+	if checker, ok := s.backend.(existenceChecker); ok && op == logical.UpdateOperation {
+		checkFound, exists, err := checker.HandleExistenceCheck(ctx, req)
+		if err != nil {
+			respondError(w, req, nil, err)
+			return
+		}
+		if checkFound && !exists {
+			req.Operation = logical.CreateOperation
+		}
+	}
+
+	resp, err := s.backend.HandleRequest(ctx, req)
+	if respondError(w, req, resp, err) {
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	out := &response{
+		Data:     resp.Data,
+		Warnings: resp.Warnings,
+	}
+
+	if resp.Secret != nil {
+		out.LeaseID = s.addLease(path, resp.Secret)
+		out.Renewable = resp.Secret.Renewable
+		out.LeaseDuration = int(resp.Secret.TTL.Seconds())
+	}
+
+	respondJSON(w, out)
+}
+
+// addLease stores a secret issued by the backend under a new
+// lease ID, applying the system TTLs as Vault would.
+func (s *devServer) addLease(path string, secret *logical.Secret) string {
+	secret.IssueTime = time.Now()
+	s.applyTTLs(secret)
+
+	leaseID := s.mount + path + "/" + uuid.New().String()
+	secret.LeaseID = leaseID
+
+	s.lock.Lock()
+	s.leases[leaseID] = secret
+	s.lock.Unlock()
+
+	return leaseID
+}
+
+func (s *devServer) applyTTLs(secret *logical.Secret) {
+	if secret.TTL == 0 {
+		secret.TTL = s.system.DefaultLeaseTTL()
+	}
+	if secret.TTL > s.system.MaxLeaseTTL() {
+		secret.TTL = s.system.MaxLeaseTTL()
+	}
+	if secret.MaxTTL > 0 && secret.TTL > secret.MaxTTL {
+		secret.TTL = secret.MaxTTL
+	}
+}
+
+// lease returns a copy of the lease named in the request data,
+// so that a renewal can update it without holding the lock while
+// the backend handles the request. The lease is only replaced
+// once the renewal succeeds.
+func (s *devServer) lease(data map[string]interface{}) (string, *logical.Secret, error) {
+	leaseID, _ := data["lease_id"].(string)
+	if leaseID == "" {
+		return "", nil, errors.New("missing lease_id")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	secret, ok := s.leases[leaseID]
+	if !ok {
+		return "", nil, fmt.Errorf("lease %q not found", leaseID)
+	}
+
+	lease := *secret
+	return leaseID, &lease, nil
+}
+
+func (s *devServer) handleRevoke(w http.ResponseWriter, ctx context.Context, data map[string]interface{}) {
+	leaseID, secret, err := s.lease(data)
+	if err != nil {
+		logical.RespondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	req := &logical.Request{
+		ID:         uuid.New().String(),
+		Operation:  logical.RevokeOperation,
+		Storage:    s.storage,
+		Secret:     secret,
+		MountPoint: s.mount,
+	}
+
+	resp, err := s.backend.HandleRequest(ctx, req)
+	if respondError(w, req, resp, err) {
+		return
+	}
+
+	s.lock.Lock()
+	delete(s.leases, leaseID)
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *devServer) handleRenew(w http.ResponseWriter, ctx context.Context, data map[string]interface{}) {
+	leaseID, secret, err := s.lease(data)
+	if err != nil {
+		logical.RespondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if raw, ok := data["increment"]; ok {
+		increment, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			logical.RespondError(w, http.StatusBadRequest, err)
+			return
+		}
+		secret.Increment = increment
+	}
+
+	req := &logical.Request{
+		ID:         uuid.New().String(),
+		Operation:  logical.RenewOperation,
+		Storage:    s.storage,
+		Secret:     secret,
+		MountPoint: s.mount,
+	}
+
+	resp, err := s.backend.HandleRequest(ctx, req)
+	if respondError(w, req, resp, err) {
+		return
+	}
+
+	if resp != nil && resp.Secret != nil {
+		secret = resp.Secret
+	}
+	s.applyTTLs(secret)
+
+	s.lock.Lock()
+	s.leases[leaseID] = secret
+	s.lock.Unlock()
+
+	respondJSON(w, &response{
+		LeaseID:       leaseID,
+		Renewable:     secret.Renewable,
+		LeaseDuration: int(secret.TTL.Seconds()),
+	})
+}
+
+// respondError writes an error response using the status codes
+// Vault would, and reports whether it did.
+func respondError(w http.ResponseWriter, req *logical.Request, resp *logical.Response, err error) bool {
+	status, err := logical.RespondErrorCommon(req, resp, err)
+	if status == 0 && err == nil {
+		return false
+	}
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+
+	logical.RespondError(w, status, err)
+	return true
+}
+
+func respondJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/solution/internal/fakehashicups"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDevServer drives the secrets engine through the HTTP API
+// the way a client would, against the fake HashiCups API.
+func TestDevServer(t *testing.T) {
+	logger := hclog.NewNullLogger()
+
+	fake, err := fakehashicups.Start(logger)
+	require.NoError(t, err)
+	defer fake.Close()
+
+	s, err := newMount(context.Background(), logger, "hashicups")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	status, _ := testDevRequest(t, server, http.MethodPut, "hashicups/config", map[string]interface{}{
+		"username": devUsername,
+		"password": devPassword,
+		"url":      fake.URL,
+	})
+	require.Equal(t, http.StatusNoContent, status)
+
+	status, _ = testDevRequest(t, server, http.MethodPut, "hashicups/role/test", map[string]interface{}{
+		"username": devUsername,
+	})
+	require.Equal(t, http.StatusNoContent, status)
+
+	t.Run("Revoke Lease", func(t *testing.T) {
+		status, resp := testDevRequest(t, server, http.MethodGet, "hashicups/creds/test", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.NotEmpty(t, resp.LeaseID)
+
+		token := resp.Data["token"].(string)
+		require.True(t, fake.IsActive(token))
+
+		revoke := map[string]interface{}{"lease_id": resp.LeaseID}
+		status, _ = testDevRequest(t, server, http.MethodPut, "sys/leases/revoke", revoke)
+		require.Equal(t, http.StatusNoContent, status)
+		require.False(t, fake.IsActive(token))
+
+		// The lease is gone once revoked
+		status, _ = testDevRequest(t, server, http.MethodPut, "sys/leases/revoke", revoke)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("Renew Lease", func(t *testing.T) {
+		status, resp := testDevRequest(t, server, http.MethodGet, "hashicups/creds/test", nil)
+		require.Equal(t, http.StatusOK, status)
+
+		// Concurrent renewals of a lease each get a response
+		var wg sync.WaitGroup
+		statuses := make([]int, 4)
+		for i := range statuses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				statuses[i], _ = testDevRequest(t, server, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+					"lease_id":  resp.LeaseID,
+					"increment": 60,
+				})
+			}(i)
+		}
+		wg.Wait()
+
+		for _, status := range statuses {
+			require.Equal(t, http.StatusOK, status)
+		}
+
+		status, _ = testDevRequest(t, server, http.MethodPut, "sys/leases/revoke", map[string]interface{}{
+			"lease_id": resp.LeaseID,
+		})
+		require.Equal(t, http.StatusNoContent, status)
+	})
+
+	t.Run("Revoke Batch Token", func(t *testing.T) {
+		status, resp := testDevRequest(t, server, http.MethodPut, "hashicups/creds/test/batch", map[string]interface{}{
+			"count": 2,
+		})
+		require.Equal(t, http.StatusOK, status)
+		require.NotEmpty(t, resp.LeaseID)
+
+		tokens := resp.Data["tokens"].([]interface{})
+		require.Len(t, tokens, 2)
+		first := tokens[0].(map[string]interface{})
+		second := tokens[1].(map[string]interface{})
+
+		status, _ = testDevRequest(t, server, http.MethodDelete, "hashicups/creds/test/batch/"+first["token_id"].(string), nil)
+		require.Equal(t, http.StatusNoContent, status)
+		require.False(t, fake.IsActive(first["token"].(string)))
+		require.True(t, fake.IsActive(second["token"].(string)))
+
+		status, _ = testDevRequest(t, server, http.MethodPut, "sys/leases/revoke", map[string]interface{}{
+			"lease_id": resp.LeaseID,
+		})
+		require.Equal(t, http.StatusNoContent, status)
+		require.False(t, fake.IsActive(second["token"].(string)))
+	})
+
+	// Only the client of the mount is still signed in
+	require.Equal(t, 1, fake.ActiveTokens())
+}
+
+// testDevRequest sends a request to the Vault-style API and
+// returns the status and decoded body, if there is one.
+func testDevRequest(t *testing.T, server *httptest.Server, method, path string, data map[string]interface{}) (int, *response) {
+	t.Helper()
+
+	var body bytes.Buffer
+	if data != nil {
+		require.NoError(t, json.NewEncoder(&body).Encode(data))
+	}
+
+	req, err := http.NewRequest(method, server.URL+"/v1/"+path, &body)
+	require.NoError(t, err)
+
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, nil
+	}
+
+	resp := new(response)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	return res.StatusCode, resp
+}
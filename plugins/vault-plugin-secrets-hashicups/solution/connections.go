@@ -0,0 +1,274 @@
+package secretsengine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	hashicups "github.com/hashicorp-demoapp/hashicups-client-go"
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// connectionStoragePrefix holds one entry per
+	// HashiCups connection that has issued leases.
+	connectionStoragePrefix = "connections/"
+
+	// connectionInternalDataKey is the secret internal data key
+	// holding the connection a token was issued against.
+	connectionInternalDataKey = "connection_id"
+)
+
+// hashiCupsConnection counts the leases issued against a HashiCups
+// URL and user. When the configuration moves to another URL or user,
+// the previous URL and user are kept as retired so that its tokens
+// are signed out of the instance that issued them, and are removed
+// once the last of its leases is revoked.
+type hashiCupsConnection struct {
+	Leases    int                `json:"leases"`
+	Retired   *retiredConnection `json:"retired,omitempty"`
+	RetiredAt time.Time          `json:"retired_at,omitempty"`
+}
+
+// retiredConnection is what revoking a token issued against a
+// retired connection needs. Signing a token out only takes the
+// token itself, so the password of the previous configuration is
+// not kept.
+type retiredConnection struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+}
+
+// connectionID identifies the HashiCups instance and user
+// of a configuration. The password is left out, since
+// tokens stay valid when it changes.
+func connectionID(config *hashiCupsConfig) string {
+	sum := sha256.Sum256([]byte(config.URL + "\x00" + config.Username))
+	return hex.EncodeToString(sum[:16])
+}
+
+func getConnection(ctx context.Context, s logical.Storage, id string) (*hashiCupsConnection, error) {
+	entry, err := s.Get(ctx, connectionStoragePrefix+id)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	conn := new(hashiCupsConnection)
+	if err := entry.DecodeJSON(conn); err != nil {
+		return nil, fmt.Errorf("error reading connection %q: %w", id, err)
+	}
+	return conn, nil
+}
+
+func putConnection(ctx context.Context, s logical.Storage, id string, conn *hashiCupsConnection) error {
+	entry, err := logical.StorageEntryJSON(connectionStoragePrefix+id, conn)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// leaseIssued counts a lease against the connection before its token
+// is issued, so that a configuration change while the token is being
+// issued retires the connection rather than removing it. It fails if
+// the configuration has already moved to another connection. Release
+// the count with leaseRevoked if the token is not issued.
+func (b *myBackend) leaseIssued(ctx context.Context, s logical.Storage, id string) error {
+	b.connLock.Lock()
+	defer b.connLock.Unlock()
+
+	config, err := b.getConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if config == nil || connectionID(config) != id {
+		return errors.New("the HashiCups configuration changed while issuing the token, try again")
+	}
+
+	conn, err := getConnection(ctx, s, id)
+	if err != nil {
+		return err
+	}
+
+	if conn == nil {
+		conn = new(hashiCupsConnection)
+	}
+	conn.Leases++
+
+	return putConnection(ctx, s, id, conn)
+}
+
+// leaseRevoked counts a lease revoked from the connection, and
+// removes the connection if it is retired and has no leases left.
+func (b *myBackend) leaseRevoked(ctx context.Context, s logical.Storage, id string) error {
+	b.connLock.Lock()
+	defer b.connLock.Unlock()
+
+	conn, err := getConnection(ctx, s, id)
+	if err != nil || conn == nil {
+		return err
+	}
+
+	if conn.Leases > 0 {
+		conn.Leases--
+	}
+
+	if conn.Leases == 0 && conn.Retired != nil {
+		b.dropRetiredClient(id)
+		return s.Delete(ctx, connectionStoragePrefix+id)
+	}
+
+	return putConnection(ctx, s, id, conn)
+}
+
+// configWritten retires the previous connection when the
+// configuration moves to another HashiCups URL or user, and
+// restores the current one if it had been retired before.
+func (b *myBackend) configWritten(ctx context.Context, s logical.Storage, previous, current hcframework.Entry) error {
+	var prevConfig, curConfig *hashiCupsConfig
+	if previous != nil {
+		prevConfig = previous.(*hashiCupsConfig)
+	}
+	if current != nil {
+		curConfig = current.(*hashiCupsConfig)
+	}
+	return b.retireConnection(ctx, s, prevConfig, curConfig)
+}
+
+// retireConnection keeps the previous configuration until its
+// leases drain if current points at another connection.
+func (b *myBackend) retireConnection(ctx context.Context, s logical.Storage, previous, current *hashiCupsConfig) error {
+	b.connLock.Lock()
+	defer b.connLock.Unlock()
+
+	currentID := ""
+	if current != nil {
+		currentID = connectionID(current)
+
+		conn, err := getConnection(ctx, s, currentID)
+		if err != nil {
+			return err
+		}
+
+		if conn != nil && conn.Retired != nil {
+			conn.Retired = nil
+			conn.RetiredAt = time.Time{}
+			if err := putConnection(ctx, s, currentID, conn); err != nil {
+				return err
+			}
+			b.dropRetiredClient(currentID)
+		}
+	}
+
+	if previous == nil {
+		return nil
+	}
+
+	previousID := connectionID(previous)
+	if previousID == currentID {
+		return nil
+	}
+
+	conn, err := getConnection(ctx, s, previousID)
+	if err != nil || conn == nil {
+		return err
+	}
+
+	if conn.Leases == 0 {
+		return s.Delete(ctx, connectionStoragePrefix+previousID)
+	}
+
+	conn.Retired = &retiredConnection{
+		URL:      previous.URL,
+		Username: previous.Username,
+	}
+	conn.RetiredAt = time.Now()
+	b.Logger().Info("retiring HashiCups connection until its leases are revoked", "url", previous.URL, "leases", conn.Leases)
+
+	return putConnection(ctx, s, previousID, conn)
+}
+
+// revocationClient returns the client for the connection a
+// token was issued against: the retired URL if there is one,
+// or else the current configuration.
+func (b *myBackend) revocationClient(ctx context.Context, s logical.Storage, id string) (*hashiCupsClient, error) {
+	if id == "" {
+		return b.getClient(ctx, s)
+	}
+
+	b.lock.RLock()
+	client, ok := b.retired[id]
+	b.lock.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	conn, err := getConnection(ctx, s, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn == nil || conn.Retired == nil {
+		return b.getClient(ctx, s)
+	}
+
+	// Signing out only needs the URL and the token,
+	// so the client is created without signing in.
+	client = &hashiCupsClient{
+		Client: &hashicups.Client{
+			HostURL:    conn.Retired.URL,
+			HTTPClient: &http.Client{Timeout: 10 * time.Second},
+			Auth:       hashicups.AuthStruct{Username: conn.Retired.Username},
+		},
+		connectionID: id,
+	}
+
+	b.lock.Lock()
+	b.retired[id] = client
+	b.lock.Unlock()
+
+	return client, nil
+}
+
+// dropRetiredClient removes a cached client for a retired connection.
+func (b *myBackend) dropRetiredClient(id string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.retired, id)
+}
+
+// retiredConnections returns the number of retired
+// connections that still have outstanding leases.
+func (b *myBackend) retiredConnections(ctx context.Context, s logical.Storage) (int, error) {
+	ids, err := s.List(ctx, connectionStoragePrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	retired := 0
+	for _, id := range ids {
+		if strings.HasSuffix(id, "/") {
+			continue
+		}
+
+		conn, err := getConnection(ctx, s, id)
+		if err != nil {
+			return 0, err
+		}
+		if conn != nil && conn.Retired != nil {
+			retired++
+		}
+	}
+	return retired, nil
+}
@@ -0,0 +1,216 @@
+package secretsengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConnectionRetirement checks that tokens are signed out of the
+// HashiCups instance that issued them after the config changes.
+func TestConnectionRetirement(t *testing.T) {
+	b, s := getTestBackend(t)
+	first := newTestHashiCupsServer(t)
+	second := newTestHashiCupsServer(t)
+
+	err := testConfigCreate(t, b, s, map[string]interface{}{
+		"username": username,
+		"password": password,
+		"url":      first.URL,
+	})
+	require.NoError(t, err)
+
+	_, err = testTokenRoleCreate(t, b, s, roleName, map[string]interface{}{
+		"username": username,
+	})
+	require.NoError(t, err)
+
+	t.Run("Revoke After URL Change", func(t *testing.T) {
+		resp := testIssueCreds(t, b, s)
+
+		err := testConfigUpdate(t, b, s, map[string]interface{}{
+			"url": second.URL,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, testRetiredConnections(t, b, s))
+
+		// Only what signing out needs is kept
+		entry, err := s.Get(context.Background(), connectionStoragePrefix+resp.Secret.InternalData[connectionInternalDataKey].(string))
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		require.NotContains(t, string(entry.Value), password)
+
+		require.True(t, first.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, first.IsActive(resp.Data["token"].(string)))
+		require.Equal(t, 0, testRetiredConnections(t, b, s))
+
+		keys, err := s.List(context.Background(), connectionStoragePrefix)
+		require.NoError(t, err)
+		require.Len(t, keys, 0)
+	})
+
+	t.Run("Revoke Against Current Connection", func(t *testing.T) {
+		resp := testIssueCreds(t, b, s)
+
+		require.True(t, second.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, second.IsActive(resp.Data["token"].(string)))
+	})
+
+	t.Run("Switch Back Restores Connection", func(t *testing.T) {
+		resp := testIssueCreds(t, b, s)
+
+		err := testConfigUpdate(t, b, s, map[string]interface{}{
+			"url": first.URL,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, testRetiredConnections(t, b, s))
+
+		err = testConfigUpdate(t, b, s, map[string]interface{}{
+			"url": second.URL,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, testRetiredConnections(t, b, s))
+
+		require.True(t, second.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, second.IsActive(resp.Data["token"].(string)))
+	})
+
+	t.Run("Revoke After Config Delete", func(t *testing.T) {
+		resp := testIssueCreds(t, b, s)
+
+		require.NoError(t, testConfigDelete(t, b, s))
+
+		keys, err := s.List(context.Background(), connectionStoragePrefix)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+
+		require.True(t, second.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, second.IsActive(resp.Data["token"].(string)))
+
+		keys, err = s.List(context.Background(), connectionStoragePrefix)
+		require.NoError(t, err)
+		require.Len(t, keys, 0)
+	})
+
+	t.Run("Lease Without Connection", func(t *testing.T) {
+		err := testConfigCreate(t, b, s, map[string]interface{}{
+			"username": username,
+			"password": password,
+			"url":      first.URL,
+		})
+		require.NoError(t, err)
+
+		resp := testIssueCreds(t, b, s)
+		delete(resp.Secret.InternalData, connectionInternalDataKey)
+
+		require.True(t, first.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, first.IsActive(resp.Data["token"].(string)))
+	})
+
+}
+
+func testIssueCreds(t *testing.T, b *myBackend, s logical.Storage) *logical.Response {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/" + roleName,
+		Storage:   s,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.NotNil(t, resp.Secret)
+	require.NotEmpty(t, resp.Secret.InternalData[connectionInternalDataKey])
+	return resp
+}
+
+func testRevokeCreds(t *testing.T, b *myBackend, s logical.Storage, resp *logical.Response) {
+	t.Helper()
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Storage:   s,
+	})
+	require.NoError(t, err)
+}
+
+// TestConnectionChangedWhileIssuing checks that a lease is counted
+// before its token is issued, so that a config change during the
+// sign in retires the connection the token is issued against.
+func TestConnectionChangedWhileIssuing(t *testing.T) {
+	b, s := getTestBackend(t)
+	first := newTestHashiCupsServer(t)
+	second := newTestHashiCupsServer(t)
+
+	err := testConfigCreate(t, b, s, map[string]interface{}{
+		"username": username,
+		"password": password,
+		"url":      first.URL,
+	})
+	require.NoError(t, err)
+
+	_, err = testTokenRoleCreate(t, b, s, roleName, map[string]interface{}{
+		"username": username,
+	})
+	require.NoError(t, err)
+
+	t.Run("Sign In Failure Releases Lease", func(t *testing.T) {
+		first.FailSignIn(func(n int) bool { return n > 1 })
+
+		_, err := b.createToken(context.Background(), s, &hashiCupsRoleEntry{Username: username})
+		require.Error(t, err)
+
+		conn, err := getConnection(context.Background(), s, connectionID(&hashiCupsConfig{URL: first.URL, Username: username}))
+		require.NoError(t, err)
+		require.NotNil(t, conn)
+		require.Equal(t, 0, conn.Leases)
+
+		first.FailSignIn(nil)
+	})
+
+	t.Run("Config Changed During Sign In", func(t *testing.T) {
+		// The config moves to the second server after the
+		// client signed in but before the token is returned.
+		var changed error
+		first.FailSignIn(func(int) bool {
+			first.FailSignIn(nil)
+			changed = testConfigUpdate(t, b, s, map[string]interface{}{
+				"url": second.URL,
+			})
+			return false
+		})
+
+		resp := testIssueCreds(t, b, s)
+		require.NoError(t, changed)
+		require.Equal(t, 1, testRetiredConnections(t, b, s))
+
+		require.True(t, first.IsActive(resp.Data["token"].(string)))
+		testRevokeCreds(t, b, s, resp)
+		require.False(t, first.IsActive(resp.Data["token"].(string)))
+		require.Equal(t, 0, testRetiredConnections(t, b, s))
+	})
+
+	t.Run("Stale Client Is Rejected", func(t *testing.T) {
+		stale := connectionID(&hashiCupsConfig{URL: first.URL, Username: username})
+
+		err := b.leaseIssued(context.Background(), s, stale)
+		require.Error(t, err)
+
+		conn, err := getConnection(context.Background(), s, stale)
+		require.NoError(t, err)
+		require.Nil(t, conn)
+	})
+}
+
+func testRetiredConnections(t *testing.T, b *myBackend, s logical.Storage) int {
+	t.Helper()
+	resp, err := testConfigReadResponse(t, b, s)
+	require.NoError(t, err)
+	return resp.Data["retired_connections"].(int)
+}
@@ -0,0 +1,252 @@
+//go:build go1.18
+// +build go1.18
+
+package secretsengine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzOperations are the operations a fuzzed request may use.
+// Revoke and renew are routed to the secret, not the path.
+var fuzzOperations = []logical.Operation{
+	logical.CreateOperation,
+	logical.UpdateOperation,
+	logical.ReadOperation,
+	logical.DeleteOperation,
+	logical.ListOperation,
+	logical.RevokeOperation,
+	logical.RenewOperation,
+	logical.HelpOperation,
+}
+
+func fuzzOperation(op uint8) logical.Operation {
+	return fuzzOperations[int(op)%len(fuzzOperations)]
+}
+
+// fuzzData decodes request data the way Vault decodes an HTTP
+// body, so numbers arrive as json.Number. Input that is not a
+// JSON object is sent as the value of a single field, with any
+// invalid UTF-8 replaced as the JSON decoder would.
+func fuzzData(raw string) map[string]interface{} {
+	var data map[string]interface{}
+	if err := jsonutil.DecodeJSON([]byte(raw), &data); err != nil || data == nil {
+		return map[string]interface{}{"username": strings.ToValidUTF8(raw, "\uFFFD")}
+	}
+	return data
+}
+
+// fuzzRequest sends a request and fails on errors that mean the
+// handler misbehaved. Errors caused by bad input are expected.
+func fuzzRequest(t *testing.T, b logical.Backend, req *logical.Request) (*logical.Response, bool) {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		return resp, false
+	}
+	return resp, true
+}
+
+// requireReadAfterWrite checks that every field accepted by a write
+// is returned by the following read, except sensitive fields.
+func requireReadAfterWrite(t *testing.T, schema map[string]*framework.FieldSchema, written, read map[string]interface{}) {
+	t.Helper()
+
+	d := &framework.FieldData{Raw: written, Schema: schema}
+	for name, s := range schema {
+		value, ok := d.GetOk(name)
+		if !ok || name == "name" {
+			continue
+		}
+
+		if s.DisplayAttrs != nil && s.DisplayAttrs.Sensitive {
+			require.NotContains(t, read, name)
+			continue
+		}
+
+		if s.Type == framework.TypeDurationSecond {
+			value = float64(value.(int))
+		}
+		require.Equal(t, value, read[name], "field %s", name)
+	}
+}
+
+// FuzzRole writes, reads and deletes roles with arbitrary names,
+// data and operations, and checks that a role reads back as it
+// was written.
+func FuzzRole(f *testing.F) {
+	f.Add(uint8(0), roleName, `{"username":"vault-plugin-testing","ttl":60,"max_ttl":3600}`)
+	f.Add(uint8(1), roleName, `{"ttl":"1h","max_ttl":"30m"}`)
+	f.Add(uint8(0), "Upper-Case", `{"username":"user"}`)
+	f.Add(uint8(0), "types", `{"username":["a"],"ttl":{"a":1}}`)
+	f.Add(uint8(4), "", `{}`)
+	f.Add(uint8(5), roleName, `not json`)
+
+	f.Fuzz(func(t *testing.T, op uint8, name, raw string) {
+		b, s := getTestBackend(t)
+		path := "role/" + name
+		data := fuzzData(raw)
+
+		_, ok := fuzzRequest(t, b, &logical.Request{
+			Operation: fuzzOperation(op),
+			Path:      path,
+			Data:      data,
+			Storage:   s,
+		})
+
+		if !ok || (fuzzOperation(op) != logical.CreateOperation && fuzzOperation(op) != logical.UpdateOperation) {
+			return
+		}
+
+		resp, ok := fuzzRequest(t, b, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   s,
+		})
+		require.True(t, ok, "role written to %q cannot be read", path)
+		require.NotNil(t, resp, "role written to %q was not stored", path)
+		requireReadAfterWrite(t, roleSchema(), data, resp.Data)
+
+		// Writing back what was read must not change the role.
+		first := resp.Data
+		_, ok = fuzzRequest(t, b, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      first,
+			Storage:   s,
+		})
+		require.True(t, ok, "role read from %q cannot be written back", path)
+
+		resp, ok = fuzzRequest(t, b, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   s,
+		})
+		require.True(t, ok)
+		require.Equal(t, first, resp.Data)
+
+		resp, ok = fuzzRequest(t, b, &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "role/",
+			Storage:   s,
+		})
+		require.True(t, ok)
+		require.Equal(t, []string{strings.ToLower(name)}, resp.Data["keys"])
+	})
+}
+
+// FuzzConfig writes the configuration with arbitrary data and
+// operations, and checks that it reads back as it was written
+// without returning the password.
+func FuzzConfig(f *testing.F) {
+	f.Add(uint8(0), `{"username":"vault-plugin-testing","password":"Testing!123","url":"http://localhost:19090"}`)
+	f.Add(uint8(1), `{"url":"http://localhost:19091"}`)
+	f.Add(uint8(0), `{"username":1,"password":true,"url":[]}`)
+	f.Add(uint8(3), `{}`)
+	f.Add(uint8(6), `[]`)
+
+	f.Fuzz(func(t *testing.T, op uint8, raw string) {
+		b, s := getTestBackend(t)
+		data := fuzzData(raw)
+
+		_, ok := fuzzRequest(t, b, &logical.Request{
+			Operation: fuzzOperation(op),
+			Path:      configStoragePath,
+			Data:      data,
+			Storage:   s,
+		})
+
+		if !ok || (fuzzOperation(op) != logical.CreateOperation && fuzzOperation(op) != logical.UpdateOperation) {
+			return
+		}
+
+		resp, ok := fuzzRequest(t, b, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      configStoragePath,
+			Storage:   s,
+		})
+		require.True(t, ok, "configuration cannot be read after it was written")
+		require.NotNil(t, resp)
+		requireReadAfterWrite(t, configFields.Schema(), data, resp.Data)
+	})
+}
+
+// FuzzCredentials issues, renews and revokes credentials for roles
+// with arbitrary data, including secrets with the malformed internal
+// data a storage restore can leave behind.
+func FuzzCredentials(f *testing.F) {
+	f.Add(uint8(2), `{"username":"vault-plugin-testing"}`, "", `{}`)
+	f.Add(uint8(1), `{"username":"vault-plugin-testing"}`, "/batch", `{"count":3}`)
+	f.Add(uint8(5), `{"username":"vault-plugin-testing"}`, "", `{"role":1,"token":["a"],"connection_id":{}}`)
+	f.Add(uint8(6), `{"username":"vault-plugin-testing"}`, "", `{"role":"testhashicups","token_ids":[1,"missing"]}`)
+	f.Add(uint8(6), `{"username":"vault-plugin-testing"}`, "", `{"role":"deleted"}`)
+	f.Add(uint8(1), `{"username":"vault-plugin-testing"}`, "/batch", `{"count":"many"}`)
+
+	server := newTestHashiCupsServer(f)
+
+	f.Fuzz(func(t *testing.T, op uint8, roleRaw, suffix, raw string) {
+		b, s := getTestBackend(t)
+
+		err := testConfigCreate(t, b, s, map[string]interface{}{
+			"username": username,
+			"password": password,
+			"url":      server.URL,
+		})
+		require.NoError(t, err)
+
+		_, created := fuzzRequest(t, b, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/" + roleName,
+			Data:      fuzzData(roleRaw),
+			Storage:   s,
+		})
+
+		req := &logical.Request{
+			Operation: fuzzOperation(op),
+			Path:      "creds/" + roleName + suffix,
+			Data:      fuzzData(raw),
+			Storage:   s,
+		}
+
+		// Revoke and renew act on a secret, so the data is
+		// used as its internal data instead.
+		if req.Operation == logical.RevokeOperation || req.Operation == logical.RenewOperation {
+			req.Secret = &logical.Secret{InternalData: req.Data}
+			req.Secret.InternalData["secret_type"] = hashiCupsTokenType
+			req.Data = nil
+		}
+
+		fuzzRequest(t, b, req)
+
+		if !created || suffix != "" {
+			return
+		}
+
+		resp, ok := fuzzRequest(t, b, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/" + roleName,
+			Storage:   s,
+		})
+		require.True(t, ok, "credentials cannot be issued for a role that was created")
+		require.NotNil(t, resp.Secret)
+
+		token := resp.Secret.InternalData["token"].(string)
+		require.True(t, server.IsActive(token))
+
+		_, ok = fuzzRequest(t, b, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Secret:    resp.Secret,
+			Storage:   s,
+		})
+		require.True(t, ok)
+		require.False(t, server.IsActive(token))
+	})
+}
@@ -1,13 +0,0 @@
-module github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups
-
-go 1.16
-
-require (
-	github.com/google/uuid v1.3.0
-	github.com/hashicorp-demoapp/hashicups-client-go v0.0.0-20210721190446-1df90c457bd4
-	github.com/hashicorp/go-hclog v0.16.2
-	github.com/hashicorp/vault-testing-stepwise v0.1.1
-	github.com/hashicorp/vault/api v1.1.1
-	github.com/hashicorp/vault/sdk v0.2.1
-	github.com/stretchr/testify v1.7.0
-)
@@ -2,10 +2,10 @@ package secretsengine
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -20,12 +20,27 @@ type hashiCupsToken struct {
 	Username string `json:"username"`
 	TokenID  string `json:"token_id"`
 	Token    string `json:"token"`
+
+	// ConnectionID identifies the HashiCups URL
+	// and user the token was issued by.
+	ConnectionID string `json:"connection_id"`
+}
+
+// responseData returns the token as returned to the client
+func (t *hashiCupsToken) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"token":    t.Token,
+		"token_id": t.TokenID,
+		"user_id":  t.UserID,
+		"username": t.Username,
+	}
 }
 
 // hashiCupsToken defines a secret to store for a given role
-// and how it should be revoked or renewed.
-func (b *myBackend) hashiCupsToken() *framework.Secret {
-	return &framework.Secret{
+// and how it should be revoked. Leases are renewed with the
+// TTLs of the role they were issued from.
+func (b *myBackend) hashiCupsToken() *hcframework.LeaseSecret {
+	return &hcframework.LeaseSecret{
 		Type: hashiCupsTokenType,
 		Fields: map[string]*framework.FieldSchema{
 			"token": {
@@ -33,14 +48,40 @@ func (b *myBackend) hashiCupsToken() *framework.Secret {
 				Description: "HashiCups Token",
 			},
 		},
+		Roles:  b.roles,
 		Revoke: b.tokenRevoke,
-		Renew:  b.tokenRenew,
 	}
 }
 
-// tokenRevoke removes the token from the Vault storage API and calls the client to revoke the token
+// tokenRevoke signs the token out of the HashiCups connection it was issued
+// by, which may be a retired configuration if the config has since changed
 func (b *myBackend) tokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	client, err := b.getClient(ctx, req.Storage)
+	// Batch leases revoke each token of the batch that
+	// has not already been revoked on its own.
+	ids, ok, err := batchTokenIDs(req.Secret.InternalData)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		for _, id := range ids {
+			if err := b.revokeBatchToken(ctx, req.Storage, "", id); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	// Leases issued before connections were tracked have no
+	// connection and are revoked with the current configuration.
+	connID := ""
+	if connRaw, ok := req.Secret.InternalData[connectionInternalDataKey]; ok {
+		connID, ok = connRaw.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s in secret internal data", connectionInternalDataKey)
+		}
+	}
+
+	client, err := b.revocationClient(ctx, req.Storage, connID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting client: %w", err)
 	}
@@ -61,37 +102,14 @@ func (b *myBackend) tokenRevoke(ctx context.Context, req *logical.Request, d *fr
 	if err := deleteToken(ctx, client, token); err != nil {
 		return nil, fmt.Errorf("error revoking user token: %w", err)
 	}
-	return nil, nil
-}
-
-// tokenRenew calls the client to create a new token and stores it in the Vault storage API
-func (b *myBackend) tokenRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	roleRaw, ok := req.Secret.InternalData["role"]
-	if !ok {
-		return nil, fmt.Errorf("secret is missing role internal data")
-	}
-
-	// get the role entry
-	role := roleRaw.(string)
-	roleEntry, err := b.getRole(ctx, req.Storage, role)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving role: %w", err)
-	}
 
-	if roleEntry == nil {
-		return nil, errors.New("error retrieving role: role is nil")
-	}
-
-	resp := &logical.Response{Secret: req.Secret}
-
-	if roleEntry.TTL > 0 {
-		resp.Secret.TTL = roleEntry.TTL
-	}
-	if roleEntry.MaxTTL > 0 {
-		resp.Secret.MaxTTL = roleEntry.MaxTTL
+	if connID != "" {
+		if err := b.leaseRevoked(ctx, req.Storage, connID); err != nil {
+			return nil, fmt.Errorf("error updating connection: %w", err)
+		}
 	}
 
-	return resp, nil
+	return nil, nil
 }
 
 // createToken calls the HashiCups client to sign in and returns a new token
@@ -104,10 +122,11 @@ func createToken(ctx context.Context, c *hashiCupsClient, username string) (*has
 	tokenID := uuid.New().String()
 
 	return &hashiCupsToken{
-		UserID:   response.UserID,
-		Username: username,
-		TokenID:  tokenID,
-		Token:    response.Token,
+		UserID:       response.UserID,
+		Username:     username,
+		TokenID:      tokenID,
+		Token:        response.Token,
+		ConnectionID: c.connectionID,
 	}, nil
 }
 
@@ -0,0 +1,151 @@
+// Package fakehashicups implements the parts of the HashiCups Product
+// API the secrets engine calls, for its tests and the hashicups-dev
+// command.
+package fakehashicups
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Server implements the sign in and sign out endpoints of the
+// HashiCups Product API. Any username and password are accepted,
+// and every sign in returns a new token.
+type Server struct {
+	URL string
+
+	logger hclog.Logger
+	server *http.Server
+
+	lock    sync.Mutex
+	signIns int
+	userIDs map[string]int
+	active  map[string]bool
+
+	// failSignIn, if set, fails the n-th sign in (starting at 1).
+	failSignIn func(n int) bool
+}
+
+// Start serves the fake API on a random local port.
+func Start(logger hclog.Logger) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		URL:     "http://" + ln.Addr().String(),
+		logger:  logger,
+		userIDs: make(map[string]int),
+		active:  make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signin", s.handleSignIn)
+	mux.HandleFunc("/signout", s.handleSignOut)
+
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(ln)
+
+	return s, nil
+}
+
+// Close stops the fake API.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// FailSignIn sets a function that fails the n-th sign in (starting
+// at 1) when it returns true, or clears it if fail is nil. It is
+// called without the server lock held, so it may call the server.
+func (s *Server) FailSignIn(fail func(n int) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failSignIn = fail
+}
+
+// SignIns returns the number of sign ins so far,
+// including the ones that failed.
+func (s *Server) SignIns() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.signIns
+}
+
+// ActiveTokens returns the number of tokens
+// that have not been signed out.
+func (s *Server) ActiveTokens() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.active)
+}
+
+// IsActive reports whether the token has been
+// issued and not signed out.
+func (s *Server) IsActive(token string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.active[token]
+}
+
+func (s *Server) handleSignIn(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil || creds.Username == "" || creds.Password == "" {
+		http.Error(w, "missing username or password", http.StatusUnauthorized)
+		return
+	}
+
+	s.lock.Lock()
+	s.signIns++
+	n, fail := s.signIns, s.failSignIn
+	s.lock.Unlock()
+
+	if fail != nil && fail(n) {
+		s.logger.Debug("failing sign in", "username", creds.Username, "sign_in", n)
+		http.Error(w, "sign in failed", http.StatusInternalServerError)
+		return
+	}
+
+	s.lock.Lock()
+	userID, ok := s.userIDs[creds.Username]
+	if !ok {
+		userID = len(s.userIDs) + 1
+		s.userIDs[creds.Username] = userID
+	}
+	token := fmt.Sprintf("fake-%s", uuid.New().String())
+	s.active[token] = true
+	active := len(s.active)
+	s.lock.Unlock()
+
+	s.logger.Debug("signed in", "username", creds.Username, "active_tokens", active)
+
+	// The client decodes the user ID and username by field name.
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"UserID":   userID,
+		"Username": creds.Username,
+		"token":    token,
+	})
+}
+
+func (s *Server) handleSignOut(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization")
+
+	s.lock.Lock()
+	known := s.active[token]
+	delete(s.active, token)
+	active := len(s.active)
+	s.lock.Unlock()
+
+	s.logger.Debug("signed out", "known_token", known, "active_tokens", active)
+
+	w.Write([]byte("Signed out user"))
+}
@@ -0,0 +1,147 @@
+package secretsengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// roleSchemaVersion and configSchemaVersion are the versions
+	// written with new role and config entries. Entries written
+	// before versioning was added have no version and are
+	// treated as version 0.
+	roleSchemaVersion   = 1
+	configSchemaVersion = 1
+)
+
+// migration upgrades a decoded storage entry by one schema
+// version. The migration at index n upgrades an entry from
+// version n to version n+1.
+type migration func(entry map[string]interface{}) error
+
+// roleMigrations upgrade role entries to roleSchemaVersion.
+var roleMigrations = []migration{
+	// 0 -> 1: the unversioned format only gains a version field.
+	func(entry map[string]interface{}) error { return nil },
+}
+
+// configMigrations upgrade config entries to configSchemaVersion.
+var configMigrations = []migration{
+	// 0 -> 1: the unversioned format only gains a version field.
+	func(entry map[string]interface{}) error { return nil },
+}
+
+// initialize upgrades every stored role and the config to the
+// current schema when the backend is mounted or Vault unseals.
+func (b *myBackend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// Only the node that can write to storage runs the migrations.
+	// Other nodes upgrade entries in memory as they read them.
+	replicationState := b.System().ReplicationState()
+	if (!b.System().LocalMount() && replicationState.HasState(consts.ReplicationPerformanceSecondary)) ||
+		replicationState.HasState(consts.ReplicationDRSecondary|consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+
+	if err := migrateEntry(ctx, req.Storage, configStoragePath, configMigrations); err != nil {
+		return err
+	}
+
+	names, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := migrateEntry(ctx, req.Storage, "role/"+name, roleMigrations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateEntry upgrades the entry stored at key and writes it
+// back if any migrations were applied.
+func migrateEntry(ctx context.Context, s logical.Storage, key string, migrations []migration) error {
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return nil
+	}
+
+	upgraded, changed, err := upgradeEntry(entry.Value, migrations)
+	if err != nil {
+		return fmt.Errorf("error upgrading %q: %w", key, err)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	entry.Value = upgraded
+	return s.Put(ctx, entry)
+}
+
+// upgradeEntry applies the migrations needed to bring the JSON
+// value of a storage entry to the latest version, which is
+// the number of migrations.
+func upgradeEntry(value []byte, migrations []migration) ([]byte, bool, error) {
+	var raw map[string]interface{}
+	if err := jsonutil.DecodeJSON(value, &raw); err != nil {
+		return nil, false, err
+	}
+
+	version := 0
+	if versionRaw, ok := raw["version"]; ok {
+		n, ok := versionRaw.(json.Number)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid schema version %v", versionRaw)
+		}
+
+		v, err := n.Int64()
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid schema version %v", versionRaw)
+		}
+		version = int(v)
+	}
+
+	if version > len(migrations) {
+		return nil, false, fmt.Errorf("schema version %d is newer than the supported version %d", version, len(migrations))
+	}
+
+	if version == len(migrations) {
+		return value, false, nil
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](raw); err != nil {
+			return nil, false, fmt.Errorf("error migrating from schema version %d: %w", version, err)
+		}
+	}
+	raw["version"] = version
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return upgraded, true, nil
+}
+
+// decodeEntry upgrades a storage entry in memory and decodes it into out.
+func decodeEntry(entry *logical.StorageEntry, migrations []migration, out interface{}) error {
+	value, _, err := upgradeEntry(entry.Value, migrations)
+	if err != nil {
+		return err
+	}
+
+	return jsonutil.DecodeJSON(value, out)
+}
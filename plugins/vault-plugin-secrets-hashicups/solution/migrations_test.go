@@ -0,0 +1,124 @@
+package secretsengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// Entries as they were stored before schema versioning was added.
+const (
+	testUnversionedRole   = `{"username":"vault-plugin-testing","user_id":0,"token":"","token_id":"","ttl":120000000000,"max_ttl":3600000000000}`
+	testUnversionedConfig = `{"username":"vault-plugin-testing","password":"Testing!123","url":"http://localhost:19090"}`
+)
+
+// TestMigrations checks that entries in the unversioned
+// format are upgraded when the backend is initialized.
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Schema Versions Match Migrations", func(t *testing.T) {
+		require.Equal(t, roleSchemaVersion, len(roleMigrations))
+		require.Equal(t, configSchemaVersion, len(configMigrations))
+	})
+
+	t.Run("Upgrade Unversioned Entries", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		testPutRaw(t, s, "role/"+roleName, testUnversionedRole)
+		testPutRaw(t, s, configStoragePath, testUnversionedConfig)
+
+		err := b.Initialize(ctx, &logical.InitializationRequest{Storage: s})
+		require.NoError(t, err)
+
+		require.Equal(t, roleSchemaVersion, testStoredVersion(t, s, "role/"+roleName))
+		require.Equal(t, configSchemaVersion, testStoredVersion(t, s, configStoragePath))
+
+		role, err := b.getRole(ctx, s, roleName)
+		require.NoError(t, err)
+		require.Equal(t, username, role.Username)
+		require.Equal(t, time.Duration(testTTL)*time.Second, role.TTL)
+		require.Equal(t, time.Duration(testMaxTTL)*time.Second, role.MaxTTL)
+
+		config, err := b.getConfig(ctx, s)
+		require.NoError(t, err)
+		require.Equal(t, username, config.Username)
+		require.Equal(t, password, config.Password)
+		require.Equal(t, url, config.URL)
+	})
+
+	t.Run("Initialize Is Idempotent", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		testPutRaw(t, s, "role/"+roleName, testUnversionedRole)
+
+		for i := 0; i < 2; i++ {
+			err := b.Initialize(ctx, &logical.InitializationRequest{Storage: s})
+			require.NoError(t, err)
+		}
+		require.Equal(t, roleSchemaVersion, testStoredVersion(t, s, "role/"+roleName))
+	})
+
+	t.Run("Read Before Initialize", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		testPutRaw(t, s, "role/"+roleName, testUnversionedRole)
+
+		resp, err := testTokenRoleRead(t, b, s)
+		require.NoError(t, err)
+		require.Equal(t, username, resp.Data["username"])
+		require.Equal(t, float64(testTTL), resp.Data["ttl"])
+	})
+
+	t.Run("Writes Are Versioned", func(t *testing.T) {
+		b, s := getTestBackend(t)
+
+		_, err := testTokenRoleCreate(t, b, s, roleName, map[string]interface{}{
+			"username": username,
+		})
+		require.NoError(t, err)
+		require.Equal(t, roleSchemaVersion, testStoredVersion(t, s, "role/"+roleName))
+
+		err = testConfigCreate(t, b, s, map[string]interface{}{
+			"username": username,
+			"password": password,
+			"url":      url,
+		})
+		require.NoError(t, err)
+		require.Equal(t, configSchemaVersion, testStoredVersion(t, s, configStoragePath))
+	})
+
+	t.Run("Newer Version Is Rejected", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		testPutRaw(t, s, "role/"+roleName, `{"version":99,"username":"vault-plugin-testing"}`)
+
+		err := b.Initialize(ctx, &logical.InitializationRequest{Storage: s})
+		require.Error(t, err)
+
+		_, err = b.getRole(ctx, s, roleName)
+		require.Error(t, err)
+	})
+}
+
+func testPutRaw(t *testing.T, s logical.Storage, key, value string) {
+	t.Helper()
+	err := s.Put(context.Background(), &logical.StorageEntry{
+		Key:   key,
+		Value: []byte(value),
+	})
+	require.NoError(t, err)
+}
+
+func testStoredVersion(t *testing.T, s logical.Storage, key string) int {
+	t.Helper()
+	entry, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	var stored struct {
+		Version int `json:"version"`
+	}
+	require.NoError(t, jsonutil.DecodeJSON(entry.Value, &stored))
+	return stored.Version
+}
@@ -2,9 +2,10 @@ package secretsengine
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"net/http"
+	"time"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -16,9 +17,14 @@ const (
 // hashiCupsConfig includes the minimum configuration
 // required to instantiate a new HashiCups client.
 type hashiCupsConfig struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	URL      string `json:"url"`
+	Version  int    `json:"version"`
+	Username string `json:"username" field:"username,required" display:"Username" description:"The username to access HashiCups Product API"`
+	Password string `json:"password" field:"password,required,sensitive" display:"Password" description:"The user's password to access HashiCups Product API"`
+	URL      string `json:"url" field:"url,required" display:"URL" description:"The URL for the HashiCups Product API"`
+
+	// PasswordSetAt records when the password was last
+	// written, to report the age of the credential.
+	PasswordSetAt time.Time `json:"password_set_at"`
 }
 
 // pathConfig extends the Vault API with a `/config`
@@ -26,161 +32,168 @@ type hashiCupsConfig struct {
 // or not certain attributes should be displayed,
 // required, and named. For example, password
 // is marked as sensitive and will not be output
-// when you read the configuration.
+// when you read the configuration. The fields are
+// declared by the tags on hashiCupsConfig.
 func pathConfig(b *myBackend) *framework.Path {
 	return &framework.Path{
 		Pattern: "config",
-		Fields: map[string]*framework.FieldSchema{
-			"username": {
-				Type:        framework.TypeString,
-				Description: "The username to access HashiCups Product API",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Username",
-					Sensitive: false,
-				},
-			},
-			"password": {
-				Type:        framework.TypeString,
-				Description: "The user's password to access HashiCups Product API",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Password",
-					Sensitive: true,
-				},
-			},
-			"url": {
-				Type:        framework.TypeString,
-				Description: "The URL for the HashiCups Product API",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "URL",
-					Sensitive: false,
-				},
-			},
-		},
+		Fields:  configFields.Schema(),
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
-				Callback: b.pathConfigRead,
+				Callback:    b.pathConfigRead,
+				Summary:     "Read the HashiCups backend configuration.",
+				Description: "Returns the username and URL used to access the HashiCups Product API along with the health of the connection. The password is never returned.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Example: &logical.Response{
+							Data: map[string]interface{}{
+								"username":            "vault-plugin-testing",
+								"url":                 "http://localhost:19090",
+								"last_sign_in":        "2021-08-02T15:04:05Z",
+								"last_error":          "",
+								"last_error_time":     "",
+								"client_cached":       true,
+								"retired_connections": 0,
+								"credential_age":      3600,
+								"health":              healthHealthy,
+							},
+						},
+					}},
+				},
 			},
 			logical.CreateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+				Callback:    b.config.HandleWrite,
+				Summary:     "Configure the HashiCups backend.",
+				Description: "Stores the username, password and URL used to access the HashiCups Product API.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration stored",
+					}},
+				},
 			},
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+				Callback:    b.config.HandleWrite,
+				Summary:     "Update the HashiCups backend configuration.",
+				Description: "Updates any of the username, password and URL used to access the HashiCups Product API.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration updated",
+					}},
+				},
 			},
 			logical.DeleteOperation: &framework.PathOperation{
-				Callback: b.pathConfigDelete,
+				Callback:    b.config.HandleDelete,
+				Summary:     "Delete the HashiCups backend configuration.",
+				Description: "Removes the stored configuration and resets the HashiCups client.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Configuration deleted",
+					}},
+				},
 			},
 		},
-		ExistenceCheck:  b.pathConfigExistenceCheck,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Navigation: true,
+			ItemType:   "Configuration",
+			Action:     "Configure",
+		},
+		ExistenceCheck:  b.config.ExistenceCheck,
 		HelpSynopsis:    pathConfigHelpSynopsis,
 		HelpDescription: pathConfigHelpDescription,
 	}
 }
 
-// pathConfigExistenceCheck verifies if the configuration exists.
-func (b *myBackend) pathConfigExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
-	out, err := req.Storage.Get(ctx, req.Path)
-	if err != nil {
-		return false, fmt.Errorf("existence check failed: %w", err)
-	}
+// configFields are the path fields of the
+// configuration, read from the hashiCupsConfig tags.
+var configFields = hcframework.NewFields("configuration", hashiCupsConfig{})
 
-	return out != nil, nil
-}
+// Update applies the fields of a write request to the configuration.
+func (c *hashiCupsConfig) Update(data *framework.FieldData, create bool) error {
+	if err := configFields.Update(c, data, create); err != nil {
+		return err
+	}
 
-// pathConfigRead reads the configuration and outputs non-sensitive information.
-func (b *myBackend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
+	if _, ok := data.GetOk("password"); ok {
+		c.PasswordSetAt = time.Now()
 	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"username": config.Username,
-			"url":      config.URL,
-		},
-	}, nil
+	return nil
 }
 
-// pathConfigWrite updates the configuration for the backend
-func (b *myBackend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-
-	createOperation := (req.Operation == logical.CreateOperation)
+// ResponseData returns the non-sensitive configuration
+// and the age of the password in seconds.
+func (c *hashiCupsConfig) ResponseData() map[string]interface{} {
+	respData := configFields.ResponseData(c)
 
-	if config == nil {
-		if !createOperation {
-			return nil, errors.New("config not found during update operation")
-		}
-		config = new(hashiCupsConfig)
+	// configurations written before the password
+	// time was tracked have an unknown age
+	respData["credential_age"] = nil
+	if !c.PasswordSetAt.IsZero() {
+		respData["credential_age"] = int64(time.Since(c.PasswordSetAt).Seconds())
 	}
 
-	if username, ok := data.GetOk("username"); ok {
-		config.Username = username.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing username in configuration")
-	}
+	return respData
+}
 
-	if url, ok := data.GetOk("url"); ok {
-		config.URL = url.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing url in configuration")
+// pathConfigRead reads the configuration and outputs non-sensitive
+// information along with the health of the HashiCups connection.
+func (b *myBackend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	resp, err := b.config.HandleRead(ctx, req, data)
+	if err != nil || resp == nil {
+		return resp, err
 	}
 
-	if password, ok := data.GetOk("password"); ok {
-		config.Password = password.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing password in configuration")
+	for k, v := range b.status.toResponseData() {
+		resp.Data[k] = v
 	}
+	resp.Data["client_cached"] = b.clientCached()
 
-	entry, err := logical.StorageEntryJSON(configStoragePath, config)
+	retired, err := b.retiredConnections(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
+	resp.Data["retired_connections"] = retired
+	resp.Data["health"] = b.status.health()
 
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, err
-	}
-
-	// reset the client so the next invocation will pick up the new configuration
-	b.reset()
-
-	return nil, nil
+	return resp, nil
 }
 
-// pathConfigDelete removes the configuration for the backend
-func (b *myBackend) pathConfigDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, configStoragePath)
-
-	if err == nil {
-		b.reset()
+// newConfigStore stores the configuration at the current schema
+// version, and resets the client when the configuration changes
+func newConfigStore(b *myBackend) *hcframework.Config {
+	return &hcframework.Config{
+		Key: configStoragePath,
+		New: func() hcframework.Entry {
+			return new(hashiCupsConfig)
+		},
+		Encode: func(key string, e hcframework.Entry) (*logical.StorageEntry, error) {
+			return configStorageEntry(e.(*hashiCupsConfig))
+		},
+		Decode: func(se *logical.StorageEntry, e hcframework.Entry) error {
+			return decodeEntry(se, configMigrations, e)
+		},
+		OnWrite: b.configWritten,
+		// reset the client so the next invocation will pick up the new configuration
+		OnChange: b.reset,
 	}
+}
 
-	return nil, err
+// configStorageEntry creates a storage entry for the
+// configuration at the current schema version
+func configStorageEntry(config *hashiCupsConfig) (*logical.StorageEntry, error) {
+	config.Version = configSchemaVersion
+	return logical.StorageEntryJSON(configStoragePath, config)
 }
 
-func getConfig(ctx context.Context, s logical.Storage) (*hashiCupsConfig, error) {
-	entry, err := s.Get(ctx, configStoragePath)
-	if err != nil {
+// getConfig gets the configuration from the Vault storage API
+func (b *myBackend) getConfig(ctx context.Context, s logical.Storage) (*hashiCupsConfig, error) {
+	config, err := b.config.Get(ctx, s)
+	if err != nil || config == nil {
 		return nil, err
 	}
 
-	if entry == nil {
-		return nil, nil
-	}
-
-	config := new(hashiCupsConfig)
-	if err := entry.DecodeJSON(&config); err != nil {
-		return nil, fmt.Errorf("error reading root configuration: %w", err)
-	}
-
-	// return the config, we are done
-	return config, nil
+	return config.(*hashiCupsConfig), nil
 }
 
 // pathConfigHelpSynopsis summarizes the help text for the configuration
@@ -194,4 +207,15 @@ JWTs issued to users working with the products API.
 You must sign up with a username and password and
 specify the HashiCups address for the products API
 before using this secrets backend.
+
+Reading the configuration also reports the health of the
+connection: the time of the last successful sign in, the last
+error, whether a client is cached, the age of the password in
+seconds, and a health state of "healthy", "unhealthy" or "unknown".
+
+Changing the url or username retires the previous configuration
+until every token issued through it has been revoked, so tokens
+are always signed out of the HashiCups instance that issued them.
+The number of retired configurations is reported as
+"retired_connections".
 `
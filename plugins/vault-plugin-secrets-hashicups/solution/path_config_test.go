@@ -7,6 +7,7 @@ import (
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -56,6 +57,93 @@ func TestConfig(t *testing.T) {
 	})
 }
 
+// TestConfigHealth checks the health metadata returned
+// when reading the configuration.
+func TestConfigHealth(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	server := newTestHashiCupsServer(t)
+
+	t.Run("Missing Configuration", func(t *testing.T) {
+		resp, err := testConfigReadResponse(t, b, reqStorage)
+		require.NoError(t, err)
+		require.Nil(t, resp)
+	})
+
+	err := testConfigCreate(t, b, reqStorage, map[string]interface{}{
+		"username": username,
+		"password": password,
+		"url":      server.URL,
+	})
+	require.NoError(t, err)
+
+	t.Run("Before Sign In", func(t *testing.T) {
+		resp, err := testConfigReadResponse(t, b, reqStorage)
+		require.NoError(t, err)
+		require.Equal(t, healthUnknown, resp.Data["health"])
+		require.Equal(t, false, resp.Data["client_cached"])
+		require.Equal(t, "", resp.Data["last_sign_in"])
+		require.NotNil(t, resp.Data["credential_age"])
+	})
+
+	t.Run("After Sign In", func(t *testing.T) {
+		_, err := b.getClient(context.Background(), reqStorage)
+		require.NoError(t, err)
+
+		resp, err := testConfigReadResponse(t, b, reqStorage)
+		require.NoError(t, err)
+		require.Equal(t, healthHealthy, resp.Data["health"])
+		require.Equal(t, true, resp.Data["client_cached"])
+		require.NotEmpty(t, resp.Data["last_sign_in"])
+		require.Empty(t, resp.Data["last_error"])
+	})
+
+	t.Run("After Failed Sign In", func(t *testing.T) {
+		server.FailSignIn(func(int) bool { return true })
+
+		_, err := b.createToken(context.Background(), reqStorage, &hashiCupsRoleEntry{Username: username})
+		require.Error(t, err)
+
+		resp, err := testConfigReadResponse(t, b, reqStorage)
+		require.NoError(t, err)
+		require.Equal(t, healthUnhealthy, resp.Data["health"])
+		require.NotEmpty(t, resp.Data["last_error"])
+		require.NotEmpty(t, resp.Data["last_error_time"])
+	})
+
+	t.Run("Reset On Update", func(t *testing.T) {
+		err := testConfigUpdate(t, b, reqStorage, map[string]interface{}{
+			"url": server.URL,
+		})
+		require.NoError(t, err)
+
+		resp, err := testConfigReadResponse(t, b, reqStorage)
+		require.NoError(t, err)
+		require.Equal(t, healthUnknown, resp.Data["health"])
+		require.Equal(t, false, resp.Data["client_cached"])
+	})
+}
+
+// configMetadataKeys are the health metadata
+// keys returned when reading the configuration.
+var configMetadataKeys = map[string]bool{
+	"last_sign_in":        true,
+	"last_error":          true,
+	"last_error_time":     true,
+	"client_cached":       true,
+	"retired_connections": true,
+	"credential_age":      true,
+	"health":              true,
+}
+
+func testConfigReadResponse(t *testing.T, b logical.Backend, s logical.Storage) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      configStoragePath,
+		Storage:   s,
+	})
+}
+
 func testConfigDelete(t *testing.T, b logical.Backend, s logical.Storage) error {
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
 		Operation: logical.DeleteOperation,
@@ -128,8 +216,11 @@ func testConfigRead(t *testing.T, b logical.Backend, s logical.Storage, expected
 		return resp.Error()
 	}
 
-	if len(expected) != len(resp.Data) {
-		return fmt.Errorf("read data mismatch (expected %d values, got %d)", len(expected), len(resp.Data))
+	// health metadata changes over time and is checked separately
+	for k := range resp.Data {
+		if _, ok := expected[k]; !ok && !configMetadataKeys[k] {
+			return fmt.Errorf(`unexpected data["%s"] in read output`, k)
+		}
 	}
 
 	for k, expectedV := range expected {
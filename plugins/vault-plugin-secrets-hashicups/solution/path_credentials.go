@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const (
+	// maxCredentialsBatchCount caps the number of tokens
+	// a single batch request can issue.
+	maxCredentialsBatchCount = 500
+)
+
 // pathCredentials extends the Vault API with a `/creds`
 // endpoint for a role. You can choose whether
 // or not certain attributes should be displayed,
@@ -21,17 +28,50 @@ func pathCredentials(b *myBackend) *framework.Path {
 				Type:        framework.TypeLowerCaseString,
 				Description: "Name of the role",
 				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Role Name",
+				},
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsRead,
+				Summary:     "Generate a HashiCups token.",
+				Description: "Signs in to HashiCups as the role's user and returns a leased token.",
+				Responses:   pathCredentialsResponses,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsRead,
+				Summary:     "Generate a HashiCups token.",
+				Description: "Signs in to HashiCups as the role's user and returns a leased token.",
+				Responses:   pathCredentialsResponses,
 			},
 		},
-		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.ReadOperation:   b.pathCredentialsRead,
-			logical.UpdateOperation: b.pathCredentialsRead,
+		DisplayAttrs: &framework.DisplayAttributes{
+			ItemType: "Credential",
+			Action:   "Generate",
 		},
 		HelpSynopsis:    pathCredentialsHelpSyn,
 		HelpDescription: pathCredentialsHelpDesc,
 	}
 }
 
+// pathCredentialsResponses documents the token returned
+// by the `/creds` endpoint.
+var pathCredentialsResponses = map[int][]framework.Response{
+	http.StatusOK: {{
+		Description: "OK",
+		Example: &logical.Response{
+			Data: map[string]interface{}{
+				"token":    "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9",
+				"token_id": "4f0c5c4e-2b4c-4d6a-9d5e-6d3b1c0f7a21",
+				"user_id":  1,
+				"username": "vault-plugin-testing",
+			},
+		},
+	}},
+}
+
 // pathCredentialsRead creates a new HashiCups token each time it is called if a
 // role exists.
 func (b *myBackend) pathCredentialsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -46,12 +86,12 @@ func (b *myBackend) pathCredentialsRead(ctx context.Context, req *logical.Reques
 		return nil, errors.New("error retrieving role: role is nil")
 	}
 
-	return b.createUserCreds(ctx, req, roleEntry)
+	return b.createUserCreds(ctx, req, roleName, roleEntry)
 }
 
 // createUserCreds creates a new HashiCups token to store into the Vault backend, generates
-// a response with the secrets information, and checks the TTL and MaxTTL attributes.
-func (b *myBackend) createUserCreds(ctx context.Context, req *logical.Request, role *hashiCupsRoleEntry) (*logical.Response, error) {
+// a response with the secrets information, and sets the TTL and MaxTTL from the role.
+func (b *myBackend) createUserCreds(ctx context.Context, req *logical.Request, roleName string, role *hashiCupsRoleEntry) (*logical.Response, error) {
 	token, err := b.createToken(ctx, req.Storage, role)
 	if err != nil {
 		return nil, err
@@ -60,47 +100,265 @@ func (b *myBackend) createUserCreds(ctx context.Context, req *logical.Request, r
 	// The response is divided into two objects (1) internal data and (2) data.
 	// If you want to reference any information in your code, you need to
 	// store it in internal data!
-	resp := b.Secret(hashiCupsTokenType).Response(map[string]interface{}{
-		"token":    token.Token,
-		"token_id": token.TokenID,
-		"user_id":  token.UserID,
-		"username": token.Username,
-	}, map[string]interface{}{
+	return b.leaseResponse(token.ConnectionID, roleName, role, token.responseData(), map[string]interface{}{
 		"token": token.Token,
-	})
-
-	if role.TTL > 0 {
-		resp.Secret.TTL = role.TTL
-	}
-
-	if role.MaxTTL > 0 {
-		resp.Secret.MaxTTL = role.MaxTTL
-	}
+	}), nil
+}
 
-	return resp, nil
+// leaseResponse creates the response for tokens issued against a
+// connection whose lease has been counted by leaseIssued.
+func (b *myBackend) leaseResponse(connID, roleName string, role *hashiCupsRoleEntry, data, internalData map[string]interface{}) *logical.Response {
+	internalData[connectionInternalDataKey] = connID
+	return b.tokens.Response(roleName, role, data, internalData)
 }
 
-// createToken uses the HashiCups client to sign in and get a new token
+// createToken uses the HashiCups client to sign in and get a new token.
+// The lease is counted against the connection before signing in, so the
+// connection is kept until the lease is revoked.
 func (b *myBackend) createToken(ctx context.Context, s logical.Storage, roleEntry *hashiCupsRoleEntry) (*hashiCupsToken, error) {
 	client, err := b.getClient(ctx, s)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := b.leaseIssued(ctx, s, client.connectionID); err != nil {
+		return nil, fmt.Errorf("error updating connection: %w", err)
+	}
+
 	var token *hashiCupsToken
 
 	token, err = createToken(ctx, client, roleEntry.Username)
+	b.status.record(err)
+	if err == nil && token == nil {
+		err = errors.New("no token returned")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error creating HashiCups token: %w", err)
+		return nil, b.releaseLease(ctx, s, client.connectionID, fmt.Errorf("error creating HashiCups token: %w", err))
+	}
+
+	return token, nil
+}
+
+// releaseLease releases the lease counted for a token that could
+// not be issued, and returns err along with any error releasing it.
+func (b *myBackend) releaseLease(ctx context.Context, s logical.Storage, connID string, err error) error {
+	if releaseErr := b.leaseRevoked(ctx, s, connID); releaseErr != nil {
+		return fmt.Errorf("%s, and releasing its lease failed: %s", err, releaseErr)
+	}
+	return err
+}
+
+// pathCredentialsBatch extends the Vault API with a
+// `/creds/<role>/batch` endpoint that issues several
+// tokens for a role in a single request.
+func pathCredentialsBatch(b *myBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name") + "/batch",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role",
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Role Name",
+				},
+			},
+			"count": {
+				Type:        framework.TypeInt,
+				Description: fmt.Sprintf("Number of tokens to generate, up to the max_batch_count of the role, or %d.", maxCredentialsBatchCount),
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Count",
+				},
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsBatchWrite,
+				Summary:     "Generate several HashiCups tokens.",
+				Description: "Signs in to HashiCups as the role's user count times and returns the tokens under a single lease, along with any sign ins that failed. Each token can also be revoked on its own by its token_id.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Example: &logical.Response{
+							Data: map[string]interface{}{
+								"tokens": []map[string]interface{}{
+									pathCredentialsResponses[http.StatusOK][0].Example.Data,
+								},
+								"requested": 2,
+								"issued":    1,
+								"failures": []map[string]interface{}{
+									{"index": 1, "error": "error creating HashiCups token: status: 500"},
+								},
+							},
+						},
+					}},
+				},
+			},
+		},
+		DisplayAttrs: &framework.DisplayAttributes{
+			ItemType: "Credential",
+			Action:   "Generate",
+		},
+		HelpSynopsis:    pathCredentialsBatchHelpSyn,
+		HelpDescription: pathCredentialsBatchHelpDesc,
+	}
+}
+
+// pathCredentialsBatchWrite creates count HashiCups tokens for a role. Sign ins
+// that fail are reported in the response instead of failing the request, as
+// long as at least one token was issued.
+func (b *myBackend) pathCredentialsBatchWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get("name").(string)
+
+	count := d.Get("count").(int)
+	if count < 1 {
+		return logical.ErrorResponse("count must be at least 1"), nil
+	}
+
+	if count > maxCredentialsBatchCount {
+		return logical.ErrorResponse("count cannot be greater than %d", maxCredentialsBatchCount), nil
+	}
+
+	roleEntry, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %w", err)
+	}
+
+	if roleEntry == nil {
+		return nil, errors.New("error retrieving role: role is nil")
 	}
 
-	if token == nil {
-		return nil, errors.New("error creating HashiCups token")
+	if count > roleEntry.batchCount() {
+		return logical.ErrorResponse("count cannot be greater than the max_batch_count of %d for role %q", roleEntry.batchCount(), roleName), nil
+	}
+
+	client, err := b.getClient(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]map[string]interface{}, 0, count)
+	tokenIDs := make([]string, 0, count)
+	failures := make([]map[string]interface{}, 0)
+
+	for i := 0; i < count; i++ {
+		token, err := b.issueBatchToken(ctx, req.Storage, client, roleName, roleEntry)
+		if err != nil {
+			failures = append(failures, map[string]interface{}{
+				"index": i,
+				"error": err.Error(),
+			})
+			continue
+		}
+
+		tokens = append(tokens, token.responseData())
+		tokenIDs = append(tokenIDs, token.TokenID)
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("error creating HashiCups tokens: %s", failures[0]["error"])
+	}
+
+	// Vault attaches a single lease to a response. It revokes every
+	// token in the batch, and each token can be revoked before it
+	// through `/creds/<role>/batch/<token_id>`.
+	resp := b.tokens.Response(roleName, roleEntry, map[string]interface{}{
+		"tokens":    tokens,
+		"requested": count,
+		"issued":    len(tokens),
+		"failures":  failures,
+	}, map[string]interface{}{
+		batchTokenIDsInternalDataKey: tokenIDs,
+	})
+
+	if len(failures) > 0 {
+		resp.AddWarning(fmt.Sprintf("issued %d of %d requested tokens", len(tokens), count))
+	}
+
+	return resp, nil
+}
+
+// issueBatchToken signs in for one token of a batch. Like tokens from
+// `/creds`, its lease is counted against the connection before signing
+// in, and it is stored so that it can be revoked on its own.
+func (b *myBackend) issueBatchToken(ctx context.Context, s logical.Storage, client *hashiCupsClient, roleName string, role *hashiCupsRoleEntry) (*hashiCupsToken, error) {
+	if err := b.leaseIssued(ctx, s, client.connectionID); err != nil {
+		return nil, fmt.Errorf("error updating connection: %w", err)
+	}
+
+	token, err := createToken(ctx, client, role.Username)
+	b.status.record(err)
+	if err != nil {
+		return nil, b.releaseLease(ctx, s, client.connectionID, err)
+	}
+
+	err = putBatchToken(ctx, s, token.TokenID, &hashiCupsBatchToken{
+		Role:         roleName,
+		Token:        token.Token,
+		ConnectionID: token.ConnectionID,
+	})
+	if err != nil {
+		deleteToken(ctx, client, token.Token)
+		return nil, b.releaseLease(ctx, s, client.connectionID, fmt.Errorf("error storing token: %w", err))
 	}
 
 	return token, nil
 }
 
+// pathCredentialsBatchToken extends the Vault API with a
+// `/creds/<role>/batch/<token_id>` endpoint that revokes
+// a single token of a batch.
+func pathCredentialsBatchToken(b *myBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name") + "/batch/" + framework.GenericNameRegex("token_id"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role",
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Role Name",
+				},
+			},
+			"token_id": {
+				Type:        framework.TypeString,
+				Description: "The token_id of a token returned by a batch request.",
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Token ID",
+				},
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:    b.pathCredentialsBatchTokenDelete,
+				Summary:     "Revoke a single HashiCups token of a batch.",
+				Description: "Signs the token out of HashiCups without revoking the other tokens of its batch. Revoking a token that was already revoked, or that was issued from another role, does nothing.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "Token revoked",
+					}},
+				},
+			},
+		},
+		DisplayAttrs: &framework.DisplayAttributes{
+			ItemType: "Credential",
+			Action:   "Revoke",
+		},
+		HelpSynopsis:    pathCredentialsBatchTokenHelpSyn,
+		HelpDescription: pathCredentialsBatchTokenHelpDesc,
+	}
+}
+
+// pathCredentialsBatchTokenDelete revokes a token of a batch ahead of its lease.
+func (b *myBackend) pathCredentialsBatchTokenDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := b.revokeBatchToken(ctx, req.Storage, d.Get("name").(string), d.Get("token_id").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 const pathCredentialsHelpSyn = `
 Generate a HashiCups API token from a specific Vault role.
 `
@@ -110,3 +368,30 @@ This path generates a HashiCups API user tokens
 based on a particular role. A role can only represent a user token,
 since HashiCups doesn't have other types of tokens.
 `
+
+const pathCredentialsBatchHelpSyn = `
+Generate several HashiCups API tokens from a specific Vault role.
+`
+
+const pathCredentialsBatchHelpDesc = `
+This path generates up to 500 HashiCups API user tokens
+for a role in one request, or up to the max_batch_count of
+the role if it is lower. Sign ins that fail are listed under
+"failures" and do not fail the request unless no token could
+be issued.
+
+Vault attaches a single lease to a response, so revoking the
+lease signs out every token in the batch. To revoke one token
+without the others, delete creds/<role>/batch/<token_id>.
+`
+
+const pathCredentialsBatchTokenHelpSyn = `
+Revoke a single HashiCups API token of a batch.
+`
+
+const pathCredentialsBatchTokenHelpDesc = `
+This path signs out one token returned by creds/<role>/batch,
+identified by its token_id, while the other tokens of the batch
+stay valid. The batch lease only revokes the tokens that are
+left when it expires or is revoked.
+`
@@ -9,6 +9,7 @@ import (
 	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/helper/logging"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
 )
 
 // newAcceptanceTestEnv creates a test environment for credentials
@@ -56,3 +57,226 @@ func TestAcceptanceUserToken(t *testing.T) {
 	t.Run("read user token cred", acceptanceTestEnv.ReadUserToken)
 	t.Run("cleanup user tokens", acceptanceTestEnv.CleanupUserTokens)
 }
+
+// TestCredentialsBatch uses a fake HashiCups API to check
+// that batch requests issue, cap and revoke tokens.
+func TestCredentialsBatch(t *testing.T) {
+	b, s := getTestBackend(t)
+	server := newTestHashiCupsServer(t)
+
+	err := testConfigCreate(t, b, s, map[string]interface{}{
+		"username": username,
+		"password": password,
+		"url":      server.URL,
+	})
+	require.NoError(t, err)
+
+	_, err = testTokenRoleCreate(t, b, s, roleName, map[string]interface{}{
+		"username": username,
+		"ttl":      testTTL,
+		"max_ttl":  testMaxTTL,
+	})
+	require.NoError(t, err)
+
+	t.Run("Issue Batch", func(t *testing.T) {
+		resp, err := testCredentialsBatch(t, b, s, roleName, 5)
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		require.Len(t, resp.Data["tokens"], 5)
+		require.Equal(t, 5, resp.Data["issued"])
+		require.Empty(t, resp.Data["failures"])
+		require.Empty(t, resp.Warnings)
+
+		require.NotNil(t, resp.Secret)
+		require.Len(t, resp.Secret.InternalData[batchTokenIDsInternalDataKey], 5)
+		require.Equal(t, roleName, resp.Secret.InternalData["role"])
+		require.Equal(t, time.Duration(testTTL)*time.Second, resp.Secret.TTL)
+		require.Equal(t, time.Duration(testMaxTTL)*time.Second, resp.Secret.MaxTTL)
+	})
+
+	t.Run("Revoke Batch", func(t *testing.T) {
+		before := server.ActiveTokens()
+
+		resp, err := testCredentialsBatch(t, b, s, roleName, 3)
+		require.NoError(t, err)
+		require.Equal(t, before+3, server.ActiveTokens())
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Secret:    resp.Secret,
+			Storage:   s,
+		})
+		require.NoError(t, err)
+		require.Equal(t, before, server.ActiveTokens())
+
+		for _, token := range resp.Data["tokens"].([]map[string]interface{}) {
+			entry, err := s.Get(context.Background(), batchTokenStoragePrefix+token["token_id"].(string))
+			require.NoError(t, err)
+			require.Nil(t, entry)
+		}
+	})
+
+	t.Run("Revoke One Token", func(t *testing.T) {
+		leases := testConnectionLeases(t, s, server.URL)
+
+		resp, err := testCredentialsBatch(t, b, s, roleName, 3)
+		require.NoError(t, err)
+
+		tokens := resp.Data["tokens"].([]map[string]interface{})
+		revoked := tokens[1]
+
+		// A token of the batch cannot be revoked through another role
+		_, err = testCredentialsBatchTokenDelete(t, b, s, "other-role", revoked["token_id"].(string))
+		require.NoError(t, err)
+		require.True(t, server.IsActive(revoked["token"].(string)))
+
+		_, err = testCredentialsBatchTokenDelete(t, b, s, roleName, revoked["token_id"].(string))
+		require.NoError(t, err)
+		require.False(t, server.IsActive(revoked["token"].(string)))
+		for _, token := range []map[string]interface{}{tokens[0], tokens[2]} {
+			require.True(t, server.IsActive(token["token"].(string)))
+		}
+
+		// Revoking it again does nothing
+		_, err = testCredentialsBatchTokenDelete(t, b, s, roleName, revoked["token_id"].(string))
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Secret:    resp.Secret,
+			Storage:   s,
+		})
+		require.NoError(t, err)
+		for _, token := range tokens {
+			require.False(t, server.IsActive(token["token"].(string)))
+		}
+
+		require.Equal(t, leases, testConnectionLeases(t, s, server.URL))
+	})
+
+	t.Run("Retry Failed Revocation", func(t *testing.T) {
+		leases := testConnectionLeases(t, s, server.URL)
+
+		resp, err := testCredentialsBatch(t, b, s, roleName, 1)
+		require.NoError(t, err)
+		token := resp.Data["tokens"].([]map[string]interface{})[0]
+		tokenID := token["token_id"].(string)
+
+		// The lease cannot be released, so the token is kept
+		connKey := connectionStoragePrefix + connectionID(&hashiCupsConfig{URL: server.URL, Username: username})
+		failing := &testFailingStorage{Storage: s, failKey: connKey}
+		_, err = testCredentialsBatchTokenDelete(t, b, failing, roleName, tokenID)
+		require.Error(t, err)
+
+		entry, err := s.Get(context.Background(), batchTokenStoragePrefix+tokenID)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+
+		_, err = testCredentialsBatchTokenDelete(t, b, s, roleName, tokenID)
+		require.NoError(t, err)
+		require.False(t, server.IsActive(token["token"].(string)))
+
+		entry, err = s.Get(context.Background(), batchTokenStoragePrefix+tokenID)
+		require.NoError(t, err)
+		require.Nil(t, entry)
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Secret:    resp.Secret,
+			Storage:   s,
+		})
+		require.NoError(t, err)
+		require.Equal(t, leases, testConnectionLeases(t, s, server.URL))
+	})
+
+	t.Run("Partial Failure", func(t *testing.T) {
+		failAfter := server.SignIns()
+		server.FailSignIn(func(n int) bool { return n > failAfter && n%2 == 0 })
+		defer server.FailSignIn(nil)
+
+		resp, err := testCredentialsBatch(t, b, s, roleName, 4)
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		require.Equal(t, 4, resp.Data["requested"])
+		require.Equal(t, 2, resp.Data["issued"])
+		require.Len(t, resp.Data["failures"], 2)
+		require.Len(t, resp.Warnings, 1)
+	})
+
+	t.Run("Count Limits", func(t *testing.T) {
+		for _, count := range []int{0, -1, maxCredentialsBatchCount + 1} {
+			resp, err := testCredentialsBatch(t, b, s, roleName, count)
+			require.NoError(t, err)
+			require.True(t, resp.IsError(), "count %d should be rejected", count)
+		}
+	})
+
+	t.Run("Role Count Limit", func(t *testing.T) {
+		_, err := testTokenRoleUpdate(t, b, s, map[string]interface{}{
+			"max_batch_count": 2,
+		})
+		require.NoError(t, err)
+		defer testTokenRoleUpdate(t, b, s, map[string]interface{}{
+			"max_batch_count": 0,
+		})
+
+		before := server.ActiveTokens()
+		resp, err := testCredentialsBatch(t, b, s, roleName, 3)
+		require.NoError(t, err)
+		require.True(t, resp.IsError())
+		require.Equal(t, before, server.ActiveTokens())
+
+		resp, err = testCredentialsBatch(t, b, s, roleName, 2)
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		for _, count := range []int{-1, maxCredentialsBatchCount + 1} {
+			resp, err := testTokenRoleCreate(t, b, s, "bad-batch", map[string]interface{}{
+				"username":        username,
+				"max_batch_count": count,
+			})
+			require.NoError(t, err)
+			require.True(t, resp.IsError(), "max_batch_count %d should be rejected", count)
+		}
+	})
+
+	t.Run("Missing Role", func(t *testing.T) {
+		_, err := testCredentialsBatch(t, b, s, "missing", 1)
+		require.Error(t, err)
+	})
+}
+
+// testConnectionLeases returns the number of leases counted
+// against the connection to url.
+func testConnectionLeases(t *testing.T, s logical.Storage, url string) int {
+	t.Helper()
+	conn, err := getConnection(context.Background(), s, connectionID(&hashiCupsConfig{URL: url, Username: username}))
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	return conn.Leases
+}
+
+// Utility function to revoke a token of a batch, returning any response (including errors)
+func testCredentialsBatchTokenDelete(t *testing.T, b logical.Backend, s logical.Storage, name, tokenID string) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "creds/" + name + "/batch/" + tokenID,
+		Storage:   s,
+	})
+}
+
+// Utility function to request a batch of tokens, returning any response (including errors)
+func testCredentialsBatch(t *testing.T, b logical.Backend, s logical.Storage, name string, count int) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "creds/" + name + "/batch",
+		Data: map[string]interface{}{
+			"count": count,
+		},
+		Storage: s,
+	})
+}
@@ -0,0 +1,461 @@
+package secretsengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// exportVersion is the version of the document returned
+	// by `/export`. Bump it when the document changes shape.
+	exportVersion = 1
+
+	diffCreated   = "created"
+	diffUpdated   = "updated"
+	diffUnchanged = "unchanged"
+	diffSkipped   = "skipped"
+)
+
+// roleNameRegex matches the role names accepted by the `/role` endpoint.
+var roleNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+// pathExport extends the Vault API with `/export` and `/import`
+// endpoints that copy role definitions and the configuration,
+// without its password, between mounts.
+func pathExport(b *myBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "export",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:    b.pathExportRead,
+					Summary:     "Export the HashiCups roles and configuration.",
+					Description: "Returns a versioned document with every role and the configuration without its password.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example: &logical.Response{
+								Data: map[string]interface{}{
+									"version": exportVersion,
+									"config": map[string]interface{}{
+										"username": "vault-plugin-testing",
+										"url":      "http://localhost:19090",
+									},
+									"roles": map[string]interface{}{
+										"my-role": exampleRoleEntry.ResponseData(),
+									},
+								},
+							},
+						}},
+					},
+				},
+			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				ItemType: "Export",
+				Action:   "Export",
+			},
+			HelpSynopsis:    pathExportHelpSynopsis,
+			HelpDescription: pathExportHelpDescription,
+		},
+		{
+			Pattern: "import",
+			Fields: map[string]*framework.FieldSchema{
+				"version": {
+					Type:        framework.TypeInt,
+					Description: "Version of the exported document.",
+					Required:    true,
+				},
+				"config": {
+					Type:        framework.TypeMap,
+					Description: "Configuration to import, without the password.",
+				},
+				"roles": {
+					Type:        framework.TypeMap,
+					Description: "Roles to import, keyed by role name.",
+				},
+				"include_config": {
+					Type:        framework.TypeBool,
+					Description: "Import the configuration as well as the roles. The target mount must already be configured with a password.",
+					Default:     false,
+				},
+				"dry_run": {
+					Type:        framework.TypeBool,
+					Description: "Return the changes the import would make without writing them.",
+					Default:     false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:    b.pathImportWrite,
+					Summary:     "Import HashiCups roles and configuration.",
+					Description: "Writes the roles, and optionally the configuration, from a document returned by the export endpoint. Either every change is written or none are.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example: &logical.Response{
+								Data: map[string]interface{}{
+									"dry_run":        true,
+									"config":         diffSkipped,
+									"config_changes": map[string]interface{}{},
+									"roles": map[string]interface{}{
+										"my-role": diffCreated,
+									},
+									"role_changes": map[string]interface{}{
+										"my-role": map[string]interface{}{
+											"username": map[string]interface{}{
+												"old": nil,
+												"new": "vault-plugin-testing",
+											},
+										},
+									},
+								},
+							},
+						}},
+					},
+				},
+			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				ItemType: "Export",
+				Action:   "Import",
+			},
+			HelpSynopsis:    pathImportHelpSynopsis,
+			HelpDescription: pathImportHelpDescription,
+		},
+	}
+}
+
+// pathExportRead returns every role and the configuration without its password
+func (b *myBackend) pathExportRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	respData := map[string]interface{}{
+		"version": exportVersion,
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if config != nil {
+		respData["config"] = map[string]interface{}{
+			"username": config.Username,
+			"url":      config.URL,
+		}
+	}
+
+	names, err := b.roles.List(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		role, err := b.getRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading role %q: %w", name, err)
+		}
+
+		if role == nil {
+			continue
+		}
+
+		roles[name] = role.ResponseData()
+	}
+	respData["roles"] = roles
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// pathImportWrite validates every role in the document before writing
+// any of them, and puts back the previous entries if a write fails
+func (b *myBackend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if version := d.Get("version").(int); version != exportVersion {
+		return logical.ErrorResponse("unsupported export version %d, expected %d", version, exportVersion), nil
+	}
+
+	dryRun := d.Get("dry_run").(bool)
+
+	var entries []*logical.StorageEntry
+	roleDiff := make(map[string]interface{})
+	roleChanges := make(map[string]interface{})
+
+	rolesRaw := d.Get("roles").(map[string]interface{})
+	names, err := importedRoleNames(rolesRaw)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	for _, rawName := range names {
+		roleRaw := rolesRaw[rawName]
+		name := strings.ToLower(rawName)
+
+		existing, err := b.getRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading role %q: %w", name, err)
+		}
+
+		// keep any fields that are not part of the export
+		role := new(hashiCupsRoleEntry)
+		if existing != nil {
+			*role = *existing
+		}
+
+		if err := parseImportedRole(name, roleRaw, role); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		var previousData map[string]interface{}
+		if existing != nil {
+			previousData = existing.ResponseData()
+		}
+		changes := fieldChanges(previousData, role.ResponseData())
+
+		switch {
+		case existing == nil:
+			roleDiff[name] = diffCreated
+		case len(changes) == 0:
+			roleDiff[name] = diffUnchanged
+			continue
+		default:
+			roleDiff[name] = diffUpdated
+		}
+		roleChanges[name] = changes
+
+		entry, err := roleStorageEntry(name, role)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	configDiff := diffSkipped
+	configChanges := make(map[string]interface{})
+	var previous, config *hashiCupsConfig
+	if configRaw := d.Get("config").(map[string]interface{}); d.Get("include_config").(bool) && len(configRaw) > 0 {
+		var err error
+		config, err = b.getConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		if config == nil {
+			return logical.ErrorResponse("the configuration must be written before it can be imported, since exports do not include the password"), nil
+		}
+
+		username, _ := configRaw["username"].(string)
+		url, _ := configRaw["url"].(string)
+		if username == "" || url == "" {
+			return logical.ErrorResponse("imported configuration must include username and url"), nil
+		}
+
+		configChanges = fieldChanges(map[string]interface{}{
+			"username": config.Username,
+			"url":      config.URL,
+		}, map[string]interface{}{
+			"username": username,
+			"url":      url,
+		})
+
+		configDiff = diffUnchanged
+		if len(configChanges) > 0 {
+			// keep the previous connection for revoking its leases
+			prev := *config
+			previous = &prev
+
+			config.Username = username
+			config.URL = url
+			configDiff = diffUpdated
+
+			entry, err := configStorageEntry(config)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"dry_run":        dryRun,
+			"config":         configDiff,
+			"config_changes": configChanges,
+			"roles":          roleDiff,
+			"role_changes":   roleChanges,
+		},
+	}
+
+	if dryRun {
+		return resp, nil
+	}
+
+	if err := putEntriesAtomic(ctx, req.Storage, entries); err != nil {
+		return nil, fmt.Errorf("error importing: %w", err)
+	}
+
+	if configDiff == diffUpdated {
+		// reset the client so the next invocation will pick up the new configuration
+		b.reset()
+
+		if err := b.retireConnection(ctx, req.Storage, previous, config); err != nil {
+			return nil, fmt.Errorf("error retiring previous connection: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// importedRoleNames returns the role names of an exported document in
+// order. Role names are stored in lower case, so names that differ only
+// in case would overwrite each other and are rejected.
+func importedRoleNames(rolesRaw map[string]interface{}) ([]string, error) {
+	names := make([]string, 0, len(rolesRaw))
+	for name := range rolesRaw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]string, len(names))
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if other, ok := seen[lower]; ok {
+			return nil, fmt.Errorf("roles %q and %q differ only in case", other, name)
+		}
+		seen[lower] = name
+	}
+	return names, nil
+}
+
+// fieldChanges returns the fields of current that differ from
+// previous, each with its old and new value. previous is nil
+// for an entry that does not exist yet.
+func fieldChanges(previous, current map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for field, value := range current {
+		if old, ok := previous[field]; ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		changes[field] = map[string]interface{}{
+			"old": previous[field],
+			"new": value,
+		}
+	}
+	return changes
+}
+
+// parseImportedRole decodes a role from an exported document into role,
+// accepting the same fields as the `/role` endpoint. Fields missing from
+// the document are reset to their defaults.
+func parseImportedRole(name string, roleRaw interface{}, role *hashiCupsRoleEntry) error {
+	if !roleNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid role name %q", name)
+	}
+
+	data, ok := roleRaw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("role %q must be an object", name)
+	}
+
+	d := &framework.FieldData{
+		Raw:    data,
+		Schema: roleFields.Schema(),
+	}
+	if err := d.Validate(); err != nil {
+		return fmt.Errorf("invalid role %q: %w", name, err)
+	}
+
+	if err := role.Update(d, true); err != nil {
+		return fmt.Errorf("invalid role %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// putEntriesAtomic writes every entry, restoring the previous
+// value of each key that was written if any write fails.
+func putEntriesAtomic(ctx context.Context, s logical.Storage, entries []*logical.StorageEntry) error {
+	// write in a stable order so failures are reproducible
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	previous := make([]*logical.StorageEntry, 0, len(entries))
+	for _, entry := range entries {
+		prev, err := s.Get(ctx, entry.Key)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, prev)
+	}
+
+	for i, entry := range entries {
+		if err := s.Put(ctx, entry); err != nil {
+			if rollbackErr := rollbackEntries(ctx, s, entries[:i], previous[:i]); rollbackErr != nil {
+				return fmt.Errorf("%s, and rolling it back failed: %s", err, rollbackErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollbackEntries restores the previous value of each written entry,
+// deleting the ones that did not exist. It keeps going when a key
+// fails so that as much as possible is restored, and returns every
+// key it could not restore.
+func rollbackEntries(ctx context.Context, s logical.Storage, written, previous []*logical.StorageEntry) error {
+	var failed []string
+	for i := len(written) - 1; i >= 0; i-- {
+		var err error
+		if previous[i] == nil {
+			err = s.Delete(ctx, written[i].Key)
+		} else {
+			err = s.Put(ctx, previous[i])
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", written[i].Key, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+const (
+	pathExportHelpSynopsis    = `Export the roles and configuration of the HashiCups backend.`
+	pathExportHelpDescription = `
+This path returns a versioned document containing every role and
+the configuration, without its password. Write the document to the
+"import" path of another mount to copy the roles to it.
+`
+
+	pathImportHelpSynopsis    = `Import roles and configuration into the HashiCups backend.`
+	pathImportHelpDescription = `
+This path writes the roles from a document returned by the "export"
+path. Roles in the document are created or updated; roles that are
+not in the document are left alone. The configuration is only
+imported when include_config is set, and the mount must already
+have a configuration since exports do not include the password.
+
+Role names are stored in lower case, so a document with two role
+names that differ only in case is rejected.
+
+Every role is validated before anything is written, and if a write
+fails the previous values are restored. Set dry_run to see which
+roles would be created or updated without writing them. The
+role_changes and config_changes fields list the old and new value
+of every field that would change.
+`
+)
@@ -0,0 +1,258 @@
+package secretsengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportImport copies roles between two mock
+// backends using the export and import paths.
+func TestExportImport(t *testing.T) {
+	src, srcStorage := getTestBackend(t)
+	dst, dstStorage := getTestBackend(t)
+
+	for _, s := range []logical.Storage{srcStorage, dstStorage} {
+		err := testConfigCreate(t, src, s, map[string]interface{}{
+			"username": username,
+			"password": password,
+			"url":      url,
+		})
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{"role-a", "role-b"} {
+		_, err := testTokenRoleCreate(t, src, srcStorage, name, map[string]interface{}{
+			"username": username,
+			"ttl":      testTTL,
+			"max_ttl":  testMaxTTL,
+		})
+		require.NoError(t, err)
+	}
+
+	_, err := testTokenRoleCreate(t, dst, dstStorage, "role-a", map[string]interface{}{
+		"username": "someone-else",
+	})
+	require.NoError(t, err)
+
+	doc := testExport(t, src, srcStorage)
+	require.Equal(t, exportVersion, doc["version"])
+	require.Len(t, doc["roles"], 2)
+	require.NotContains(t, doc["config"], "password")
+
+	t.Run("Dry Run", func(t *testing.T) {
+		resp, err := testImport(t, dst, dstStorage, doc, map[string]interface{}{
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+		require.Equal(t, map[string]interface{}{
+			"role-a": diffUpdated,
+			"role-b": diffCreated,
+		}, resp.Data["roles"])
+
+		changes := resp.Data["role_changes"].(map[string]interface{})
+		require.Equal(t, map[string]interface{}{
+			"old": "someone-else",
+			"new": username,
+		}, changes["role-a"].(map[string]interface{})["username"])
+		require.Equal(t, map[string]interface{}{
+			"old": nil,
+			"new": username,
+		}, changes["role-b"].(map[string]interface{})["username"])
+
+		role, err := dst.getRole(context.Background(), dstStorage, "role-b")
+		require.NoError(t, err)
+		require.Nil(t, role)
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		resp, err := testImport(t, dst, dstStorage, doc, nil)
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+		require.Equal(t, diffSkipped, resp.Data["config"])
+
+		require.Equal(t, doc["roles"], testExport(t, dst, dstStorage)["roles"])
+	})
+
+	t.Run("Import Again", func(t *testing.T) {
+		resp, err := testImport(t, dst, dstStorage, doc, nil)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"role-a": diffUnchanged,
+			"role-b": diffUnchanged,
+		}, resp.Data["roles"])
+	})
+
+	t.Run("Import Config", func(t *testing.T) {
+		doc := testExport(t, src, srcStorage)
+		doc["config"] = map[string]interface{}{
+			"username": username,
+			"url":      "http://hashicups:19090",
+		}
+
+		resp, err := testImport(t, dst, dstStorage, doc, map[string]interface{}{
+			"include_config": true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, diffUpdated, resp.Data["config"])
+		require.Equal(t, map[string]interface{}{
+			"url": map[string]interface{}{
+				"old": url,
+				"new": "http://hashicups:19090",
+			},
+		}, resp.Data["config_changes"])
+
+		config, err := dst.getConfig(context.Background(), dstStorage)
+		require.NoError(t, err)
+		require.Equal(t, "http://hashicups:19090", config.URL)
+		require.Equal(t, password, config.Password)
+	})
+
+	t.Run("Invalid Documents", func(t *testing.T) {
+		tests := map[string]map[string]interface{}{
+			"unsupported version": {
+				"version": exportVersion + 1,
+			},
+			"missing username": {
+				"roles": map[string]interface{}{
+					"role-c": map[string]interface{}{"ttl": 60},
+				},
+			},
+			"ttl over max_ttl": {
+				"roles": map[string]interface{}{
+					"role-c": map[string]interface{}{"username": username, "ttl": 60, "max_ttl": 30},
+				},
+			},
+			"names differing in case": {
+				"roles": map[string]interface{}{
+					"Role-C": map[string]interface{}{"username": "someone-else"},
+					"role-c": map[string]interface{}{"username": username},
+				},
+			},
+			"invalid name": {
+				"roles": map[string]interface{}{
+					"role/c": map[string]interface{}{"username": username},
+				},
+			},
+		}
+
+		for name, overrides := range tests {
+			t.Run(name, func(t *testing.T) {
+				bad := testExport(t, src, srcStorage)
+				for k, v := range overrides {
+					bad[k] = v
+				}
+
+				resp, err := testImport(t, dst, dstStorage, bad, nil)
+				require.NoError(t, err)
+				require.True(t, resp.IsError())
+
+				role, err := dst.getRole(context.Background(), dstStorage, "role-c")
+				require.NoError(t, err)
+				require.Nil(t, role)
+			})
+		}
+	})
+
+	t.Run("Rollback On Failure", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		storage := &testFailingStorage{Storage: s, failKey: "role/role-b"}
+
+		_, err := testTokenRoleCreate(t, b, s, "role-a", map[string]interface{}{
+			"username": "someone-else",
+		})
+		require.NoError(t, err)
+
+		_, err = testImport(t, b, storage, doc, nil)
+		require.Error(t, err)
+
+		role, err := b.getRole(context.Background(), s, "role-a")
+		require.NoError(t, err)
+		require.Equal(t, "someone-else", role.Username)
+	})
+
+	t.Run("Rollback Failure Reported", func(t *testing.T) {
+		b, s := getTestBackend(t)
+		storage := &testFailingStorage{Storage: s, failKey: "role/role-b", failRollback: true}
+
+		_, err := testTokenRoleCreate(t, b, s, "role-a", map[string]interface{}{
+			"username": "someone-else",
+		})
+		require.NoError(t, err)
+
+		_, err = testImport(t, b, storage, doc, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "put failed, and rolling it back failed: role/role-a: rollback put failed")
+	})
+}
+
+// testFailingStorage fails every write to failKey. With
+// failRollback set it also fails every write to a key
+// that was already written through it.
+type testFailingStorage struct {
+	logical.Storage
+	failKey      string
+	failRollback bool
+	written      map[string]bool
+}
+
+func (s *testFailingStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if strings.EqualFold(entry.Key, s.failKey) {
+		return errors.New("put failed")
+	}
+	if s.failRollback && s.written[entry.Key] {
+		return errors.New("rollback put failed")
+	}
+	if s.written == nil {
+		s.written = make(map[string]bool)
+	}
+	s.written[entry.Key] = true
+	return s.Storage.Put(ctx, entry)
+}
+
+// testExport reads the export document the way a
+// client would see it after decoding the JSON response.
+func testExport(t *testing.T, b logical.Backend, s logical.Storage) map[string]interface{} {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "export",
+		Storage:   s,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	raw, err := json.Marshal(resp.Data)
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &doc))
+	doc["version"] = int(doc["version"].(float64))
+
+	return doc
+}
+
+// Utility function to import a document, returning any response (including errors)
+func testImport(t *testing.T, b logical.Backend, s logical.Storage, doc map[string]interface{}, options map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	data := make(map[string]interface{})
+	for k, v := range doc {
+		data[k] = v
+	}
+	for k, v := range options {
+		data[k] = v
+	}
+
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "import",
+		Data:      data,
+		Storage:   s,
+	})
+}
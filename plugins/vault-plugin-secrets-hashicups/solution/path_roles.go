@@ -3,8 +3,10 @@ package secretsengine
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
+	hcframework "github.com/hashicorp/vault-guides/plugins/vault-plugin-secrets-hashicups/framework"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -13,67 +15,93 @@ import (
 // for a Vault role to access and call the HashiCups
 // token endpoints
 type hashiCupsRoleEntry struct {
-	Username string        `json:"username"`
+	Version  int           `json:"version"`
+	Username string        `json:"username" field:"username,required" display:"Username" description:"The username for the HashiCups product API"`
 	UserID   int           `json:"user_id"`
 	Token    string        `json:"token"`
 	TokenID  string        `json:"token_id"`
-	TTL      time.Duration `json:"ttl"`
-	MaxTTL   time.Duration `json:"max_ttl"`
+	TTL      time.Duration `json:"ttl" field:"ttl" display:"TTL" description:"Default lease for generated credentials. If not set or set to 0, will use system default."`
+	MaxTTL   time.Duration `json:"max_ttl" field:"max_ttl" display:"Max TTL" description:"Maximum time for role. If not set or set to 0, will use system default."`
+
+	MaxBatchCount int `json:"max_batch_count" field:"max_batch_count" display:"Max Batch Count" description:"Maximum number of tokens a single batch request can generate for the role, up to 500. If not set or set to 0, 500 is used."`
 }
 
-// toResponseData returns response data for a role
-func (r *hashiCupsRoleEntry) toResponseData() map[string]interface{} {
-	respData := map[string]interface{}{
-		"ttl":      r.TTL.Seconds(),
-		"max_ttl":  r.MaxTTL.Seconds(),
-		"username": r.Username,
-	}
-	return respData
+// roleFields are the path fields of a role,
+// read from the hashiCupsRoleEntry tags.
+var roleFields = hcframework.NewFields("role", hashiCupsRoleEntry{})
+
+// exampleRoleEntry is the role used to document
+// read responses in the OpenAPI output.
+var exampleRoleEntry = &hashiCupsRoleEntry{
+	Username: "vault-plugin-testing",
+	TTL:      2 * time.Minute,
+	MaxTTL:   time.Hour,
+}
+
+// ResponseData returns response data for a role
+func (r *hashiCupsRoleEntry) ResponseData() map[string]interface{} {
+	return roleFields.ResponseData(r)
 }
 
 // pathRole extends the Vault API with a `/role`
 // endpoint for the backend. You can choose whether
 // or not certain attributes should be displayed,
 // required, and named. You can also define different
-// path patterns to list all roles.
+// path patterns to list all roles. The role fields
+// are declared by the tags on hashiCupsRoleEntry.
 func pathRole(b *myBackend) []*framework.Path {
 	return []*framework.Path{
 		{
 			Pattern: "role/" + framework.GenericNameRegex("name"),
-			Fields: map[string]*framework.FieldSchema{
-				"name": {
-					Type:        framework.TypeLowerCaseString,
-					Description: "Name of the role",
-					Required:    true,
-				},
-				"username": {
-					Type:        framework.TypeString,
-					Description: "The username for the HashiCups product API",
-					Required:    true,
-				},
-				"ttl": {
-					Type:        framework.TypeDurationSecond,
-					Description: "Default lease for generated credentials. If not set or set to 0, will use system default.",
-				},
-				"max_ttl": {
-					Type:        framework.TypeDurationSecond,
-					Description: "Maximum time for role. If not set or set to 0, will use system default.",
-				},
-			},
+			Fields:  roleSchema(),
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
-					Callback: b.pathRolesRead,
+					Callback:    b.roles.HandleRead,
+					Summary:     "Read a HashiCups role.",
+					Description: "Returns the username and lease settings of the role.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example: &logical.Response{
+								Data: exampleRoleEntry.ResponseData(),
+							},
+						}},
+					},
 				},
 				logical.CreateOperation: &framework.PathOperation{
-					Callback: b.pathRolesWrite,
+					Callback:    b.roles.HandleWrite,
+					Summary:     "Create a HashiCups role.",
+					Description: "Creates a role that generates tokens for the given HashiCups username.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role created",
+						}},
+					},
 				},
 				logical.UpdateOperation: &framework.PathOperation{
-					Callback: b.pathRolesWrite,
+					Callback:    b.roles.HandleWrite,
+					Summary:     "Update a HashiCups role.",
+					Description: "Updates the username or lease settings of an existing role.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role updated",
+						}},
+					},
 				},
 				logical.DeleteOperation: &framework.PathOperation{
-					Callback: b.pathRolesDelete,
+					Callback:    b.roles.HandleDelete,
+					Summary:     "Delete a HashiCups role.",
+					Description: "Removes the role. Tokens already issued from it are not revoked.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "Role deleted",
+						}},
+					},
 				},
 			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				ItemType: "Role",
+			},
 			HelpSynopsis:    pathRoleHelpSynopsis,
 			HelpDescription: pathRoleHelpDescription,
 		},
@@ -81,137 +109,103 @@ func pathRole(b *myBackend) []*framework.Path {
 			Pattern: "role/?$",
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ListOperation: &framework.PathOperation{
-					Callback: b.pathRolesList,
+					Callback:    b.roles.HandleList,
+					Summary:     "List HashiCups roles.",
+					Description: "Returns the names of all roles configured in the backend.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Example:     logical.ListResponse([]string{"my-role"}),
+						}},
+					},
 				},
 			},
+			DisplayAttrs: &framework.DisplayAttributes{
+				Navigation: true,
+				ItemType:   "Role",
+			},
 			HelpSynopsis:    pathRoleListHelpSynopsis,
 			HelpDescription: pathRoleListHelpDescription,
 		},
 	}
 }
 
-// pathRolesList makes a request to Vault storage to retrieve a list of roles for the backend
-func (b *myBackend) pathRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entries, err := req.Storage.List(ctx, "role/")
-	if err != nil {
-		return nil, err
-	}
-
-	return logical.ListResponse(entries), nil
-}
-
-// pathRolesRead makes a request to Vault storage to read a role and return response data
-func (b *myBackend) pathRolesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entry, err := b.getRole(ctx, req.Storage, d.Get("name").(string))
-	if err != nil {
-		return nil, err
-	}
-
-	if entry == nil {
-		return nil, nil
+// roleSchema returns the role fields along with the role name
+func roleSchema() map[string]*framework.FieldSchema {
+	schema := roleFields.Schema()
+	schema["name"] = &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: "Name of the role",
+		Required:    true,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Role Name",
+		},
 	}
-
-	return &logical.Response{
-		Data: entry.toResponseData(),
-	}, nil
+	return schema
 }
 
-// pathRolesWrite makes a request to Vault storage to update a role based on the attributes passed to the role configuration
-func (b *myBackend) pathRolesWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	name, ok := d.GetOk("name")
-	if !ok {
-		return logical.ErrorResponse("missing role name"), nil
-	}
-
-	roleEntry, err := b.getRole(ctx, req.Storage, name.(string))
-	if err != nil {
-		return nil, err
-	}
-
-	if roleEntry == nil {
-		roleEntry = &hashiCupsRoleEntry{}
-	}
-
-	createOperation := (req.Operation == logical.CreateOperation)
-
-	if username, ok := d.GetOk("username"); ok {
-		roleEntry.Username = username.(string)
-	} else if !ok && createOperation {
-		return nil, fmt.Errorf("missing username in role")
-	}
-
-	if ttlRaw, ok := d.GetOk("ttl"); ok {
-		roleEntry.TTL = time.Duration(ttlRaw.(int)) * time.Second
-	} else if createOperation {
-		roleEntry.TTL = time.Duration(d.Get("ttl").(int)) * time.Second
-	}
-
-	if maxTTLRaw, ok := d.GetOk("max_ttl"); ok {
-		roleEntry.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
-	} else if createOperation {
-		roleEntry.MaxTTL = time.Duration(d.Get("max_ttl").(int)) * time.Second
+// Update applies the fields of a write request to the role.
+func (r *hashiCupsRoleEntry) Update(d *framework.FieldData, create bool) error {
+	if err := roleFields.Update(r, d, create); err != nil {
+		return err
 	}
 
-	if roleEntry.MaxTTL != 0 && roleEntry.TTL > roleEntry.MaxTTL {
-		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	if r.MaxTTL != 0 && r.TTL > r.MaxTTL {
+		return fmt.Errorf("ttl cannot be greater than max_ttl")
 	}
 
-	if err := setRole(ctx, req.Storage, name.(string), roleEntry); err != nil {
-		return nil, err
+	if r.MaxBatchCount < 0 || r.MaxBatchCount > maxCredentialsBatchCount {
+		return fmt.Errorf("max_batch_count must be between 0 and %d", maxCredentialsBatchCount)
 	}
 
-	return nil, nil
+	return nil
 }
 
-// pathRolesDelete makes a request to Vault storage to delete a role
-func (b *myBackend) pathRolesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, "role/"+d.Get("name").(string))
-	if err != nil {
-		return nil, fmt.Errorf("error deleting hashiCups role: %w", err)
+// batchCount returns the number of tokens a single
+// batch request can generate for the role.
+func (r *hashiCupsRoleEntry) batchCount() int {
+	if r.MaxBatchCount == 0 {
+		return maxCredentialsBatchCount
 	}
-
-	return nil, nil
+	return r.MaxBatchCount
 }
 
-// setRole adds the role to the Vault storage API
-func setRole(ctx context.Context, s logical.Storage, name string, roleEntry *hashiCupsRoleEntry) error {
-	entry, err := logical.StorageEntryJSON("role/"+name, roleEntry)
-	if err != nil {
-		return err
-	}
-
-	if entry == nil {
-		return fmt.Errorf("failed to create storage entry for role")
-	}
+// LeaseTTLs returns the TTLs of tokens issued from the role
+func (r *hashiCupsRoleEntry) LeaseTTLs() (time.Duration, time.Duration) {
+	return r.TTL, r.MaxTTL
+}
 
-	if err := s.Put(ctx, entry); err != nil {
-		return err
+// newRoleStore stores roles at the current schema version
+func newRoleStore() *hcframework.Roles {
+	return &hcframework.Roles{
+		New: func() hcframework.Entry {
+			return new(hashiCupsRoleEntry)
+		},
+		Encode: func(key string, e hcframework.Entry) (*logical.StorageEntry, error) {
+			e.(*hashiCupsRoleEntry).Version = roleSchemaVersion
+			return logical.StorageEntryJSON(key, e)
+		},
+		Decode: func(se *logical.StorageEntry, e hcframework.Entry) error {
+			return decodeEntry(se, roleMigrations, e)
+		},
 	}
+}
 
-	return nil
+// roleStorageEntry creates a storage entry for the
+// role at the current schema version
+func roleStorageEntry(name string, roleEntry *hashiCupsRoleEntry) (*logical.StorageEntry, error) {
+	roleEntry.Version = roleSchemaVersion
+	return logical.StorageEntryJSON("role/"+name, roleEntry)
 }
 
 // getRole gets the role from the Vault storage API
 func (b *myBackend) getRole(ctx context.Context, s logical.Storage, name string) (*hashiCupsRoleEntry, error) {
-	if name == "" {
-		return nil, fmt.Errorf("missing role name")
-	}
-
-	entry, err := s.Get(ctx, "role/"+name)
-	if err != nil {
+	role, err := b.roles.Get(ctx, s, name)
+	if err != nil || role == nil {
 		return nil, err
 	}
 
-	if entry == nil {
-		return nil, nil
-	}
-
-	var role hashiCupsRoleEntry
-
-	if err := entry.DecodeJSON(&role); err != nil {
-		return nil, err
-	}
-	return &role, nil
+	return role.(*hashiCupsRoleEntry), nil
 }
 
 const (
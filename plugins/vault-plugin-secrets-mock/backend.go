@@ -2,19 +2,50 @@ package mock
 
 import (
 	"context"
+	"crypto/cipher"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
 // backend wraps the backend framework and adds a map for storing key value pairs
 type backend struct {
 	*framework.Backend
+
+	// kvLocks serialize writes to each versioned secret, and
+	// writes of plain secrets with the revocation of their leases
+	kvLocks []*locksutil.LockEntry
+
+	// aead caches the cipher for the mount encryption key
+	keyLock sync.RWMutex
+	aead    cipher.AEAD
+
+	// faults caches the fault injection configuration, with the
+	// remaining counts of its rules, and faultRand draws its random
+	// failures. faultLock serializes them, and faultState lets
+	// requests skip the lock when no faults are configured.
+	faultLock  sync.Mutex
+	faults     *faultConfig
+	faultRand  *rand.Rand
+	faultState int32
+
+	// schemaLock serializes changes to the schemas
+	schemaLock sync.Mutex
+
+	// notifier wakes the watches of changed secrets
+	notifier *notifier
+
+	// restoreLock is held for writing by restores, and for
+	// reading by every other request while it is handled
+	restoreLock sync.RWMutex
 }
 
 var _ logical.Factory = Factory
@@ -38,19 +69,85 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 }
 
 func newBackend() (*backend, error) {
-	b := &backend{}
+	b := &backend{
+		kvLocks:  locksutil.CreateLocks(),
+		notifier: newNotifier(),
+	}
 
 	b.Backend = &framework.Backend{
 		Help:        strings.TrimSpace(mockHelp),
 		BackendType: logical.TypeLogical,
+		PathsSpecial: &logical.Paths{
+			// Snapshots hold every secret of the mount in plaintext
+			// unless encrypted, and restores replace them all
+			Root: []string{
+				snapshotPath,
+				restorePath,
+			},
+			SealWrapStorage: []string{
+				encryptionKeyPath,
+			},
+		},
 		Paths: framework.PathAppend(
+			[]*framework.Path{
+				b.pathConfig(),
+				b.pathFaults(),
+			},
+			b.kvPaths(),
+			b.schemaPaths(),
+			b.snapshotPaths(),
+			[]*framework.Path{
+				b.pathGenerate(),
+				b.pathWatch(),
+				b.pathFiles(),
+			},
 			b.paths(),
 		),
+		Secrets: []*framework.Secret{
+			b.secret(),
+		},
+		Invalidate: b.invalidate,
 	}
 
 	return b, nil
 }
 
+// invalidate drops the cached encryption key and faults
+// when they change in storage, such as on a replica,
+// and wakes the watches of secrets changed by another node.
+func (b *backend) invalidate(ctx context.Context, key string) {
+	switch key {
+	case encryptionKeyPath:
+		b.resetEncryptionKey()
+	case faultsPath:
+		b.resetFaults()
+	default:
+		b.notifier.notify(key)
+	}
+}
+
+// HandleRequest injects the configured faults before handling the
+// request. Requests to the mount configuration never fail, so that
+// faults can always be changed or removed.
+func (b *backend) HandleRequest(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	// Requests wait for restores to end, so that they never see a
+	// mount partially restored. Watches do not, since they may wait
+	// for minutes and would hold restores off.
+	if req.Path != restorePath && !strings.HasPrefix(req.Path, "watch/") {
+		b.restoreLock.RLock()
+		defer b.restoreLock.RUnlock()
+	}
+
+	operation := faultOperation(req.Operation)
+	if operation != "" && req.Path != configPath && !strings.HasPrefix(req.Path, configPath+"/") {
+		if err := b.injectFault(ctx, req.Storage, operation, req.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Backend.HandleRequest(ctx, req)
+}
+
 func (b *backend) paths() []*framework.Path {
 	return []*framework.Path{
 		{
@@ -61,6 +158,10 @@ func (b *backend) paths() []*framework.Path {
 					Type:        framework.TypeString,
 					Description: "Specifies the path of the secret.",
 				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Returns the secret as a lease with this TTL when it is read. Revoking the lease deletes the secret, unless it has been written again since.",
+				},
 			},
 
 			Operations: map[logical.Operation]framework.OperationHandler{
@@ -79,6 +180,10 @@ func (b *backend) paths() []*framework.Path {
 					Callback: b.handleDelete,
 					Summary:  "Deletes the secret at the specified location.",
 				},
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleList,
+					Summary:  "List the secrets and folders under the specified location.",
+				},
 			},
 
 			ExistenceCheck: b.handleExistenceCheck,
@@ -87,7 +192,12 @@ func (b *backend) paths() []*framework.Path {
 }
 
 func (b *backend) handleExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
-	out, err := req.Storage.Get(ctx, req.Path)
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := req.Storage.Get(ctx, namespace+data.Get("path").(string))
 	if err != nil {
 		return false, errwrap.Wrapf("existence check failed: {{err}}", err)
 	}
@@ -96,20 +206,27 @@ func (b *backend) handleExistenceCheck(ctx context.Context, req *logical.Request
 }
 
 func (b *backend) handleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	if req.ClientToken == "" {
-		return nil, fmt.Errorf("client token empty")
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	path := data.Get("path").(string)
 
 	// Decode the data
 	var rawData map[string]interface{}
-	entry, err := req.Storage.Get(ctx, req.ClientToken+"/"+path)
+	entry, err := b.getEntry(ctx, req.Storage, namespace+path)
 	if err != nil {
 		return nil, err
 	}
+
+	// A nil response is returned as a 404, as Vault KV does
+	if entry == nil {
+		return nil, nil
+	}
+
 	fetchedData := entry.Value
-	if fetchedData == nil {
+	if len(fetchedData) == 0 {
 		resp := logical.ErrorResponse("No value at %v%v", req.MountPoint, path)
 		return resp, nil
 	}
@@ -118,6 +235,16 @@ func (b *backend) handleRead(ctx context.Context, req *logical.Request, data *fr
 		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
 	}
 
+	// Secrets written with a ttl are returned as leases
+	ttl, err := secretTTL(rawData)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		return b.leaseResponse(namespace+path, secretDigest(fetchedData), rawData, ttl), nil
+	}
+
 	// Generate the response
 	resp := &logical.Response{
 		Data: rawData,
@@ -127,8 +254,9 @@ func (b *backend) handleRead(ctx context.Context, req *logical.Request, data *fr
 }
 
 func (b *backend) handleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	if req.ClientToken == "" {
-		return nil, fmt.Errorf("client token empty")
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check to make sure that kv pairs provided
@@ -138,19 +266,27 @@ func (b *backend) handleWrite(ctx context.Context, req *logical.Request, data *f
 
 	path := data.Get("path").(string)
 
+	// Reject data that does not match the schema of the path
+	if resp, err := validateSchema(ctx, req.Storage, path, req.Data); resp != nil || err != nil {
+		return resp, err
+	}
+
 	// JSON encode the data
 	buf, err := json.Marshal(req.Data)
 	if err != nil {
 		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
 	}
 
-	// Store kv pairs in map at specified path
+	// Store kv pairs in map at specified path, seal wrapped
+	// and encrypted if the mount is configured to
 	entry := &logical.StorageEntry{
-		Key:      req.ClientToken + "/" + path,
-		Value:    buf,
-		SealWrap: false,
+		Key:   namespace + path,
+		Value: buf,
 	}
-	if err = req.Storage.Put(ctx, entry); err != nil {
+
+	defer b.lockKV(entry.Key)()
+
+	if err = b.putEntry(ctx, req.Storage, entry); err != nil {
 		return nil, err
 	}
 
@@ -158,20 +294,43 @@ func (b *backend) handleWrite(ctx context.Context, req *logical.Request, data *f
 }
 
 func (b *backend) handleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	if req.ClientToken == "" {
-		return nil, fmt.Errorf("client token empty")
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	path := data.Get("path").(string)
 
 	// Remove entry for specified path
-	if err := req.Storage.Delete(ctx, req.ClientToken+"/"+path); err != nil {
+	if err := b.deleteEntry(ctx, req.Storage, namespace+path); err != nil {
 		return nil, err
 	}
 
 	return nil, nil
 }
 
+func (b *backend) handleList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := data.Get("path").(string)
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+
+	// List the keys directly under the path. Keys with
+	// more segments are returned once as a folder with
+	// a trailing slash, as Vault KV does.
+	keys, err := req.Storage.List(ctx, namespace+path)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
 const mockHelp = `
 The Mock backend is a dummy secrets backend that stores kv pairs in a map.
 `
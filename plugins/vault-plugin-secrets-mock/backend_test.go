@@ -0,0 +1,205 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const testToken = "test-token"
+
+func getTestBackend(t *testing.T) (logical.Backend, logical.Storage) {
+	t.Helper()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = new(logical.InmemStorage)
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b logical.Backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   op,
+		Path:        path,
+		Data:        data,
+		Storage:     s,
+		ClientToken: testToken,
+		MountPoint:  "mock-secrets/",
+	})
+}
+
+func TestRead(t *testing.T) {
+	cases := []struct {
+		name string
+
+		// entry is stored at the path before it is read,
+		// unless it is nil
+		entry []byte
+
+		wantData  map[string]interface{}
+		wantNil   bool
+		wantError bool
+		wantErr   bool
+	}{
+		{
+			name:    "missing",
+			wantNil: true,
+		},
+		{
+			name:      "empty",
+			entry:     []byte{},
+			wantError: true,
+		},
+		{
+			name:    "malformed",
+			entry:   []byte(`{"hello":`),
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			entry:   []byte(`["hello"]`),
+			wantErr: true,
+		},
+		{
+			name:     "empty object",
+			entry:    []byte(`{}`),
+			wantData: map[string]interface{}{},
+		},
+		{
+			name:  "valid",
+			entry: []byte(`{"hello":"world"}`),
+			wantData: map[string]interface{}{
+				"hello": "world",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			b, s := getTestBackend(t)
+
+			if tc.entry != nil {
+				err := s.Put(context.Background(), &logical.StorageEntry{
+					Key:   testToken + "/secret",
+					Value: tc.entry,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+
+			switch {
+			case tc.wantErr:
+				if err == nil {
+					t.Fatalf("expected error, got response %#v", resp)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if tc.wantNil {
+				if resp != nil {
+					t.Fatalf("expected nil response, got %#v", resp)
+				}
+				return
+			}
+
+			if resp == nil {
+				t.Fatal("expected response, got nil")
+			}
+
+			if resp.IsError() != tc.wantError {
+				t.Fatalf("expected error response %t, got %#v", tc.wantError, resp)
+			}
+
+			if !tc.wantError && !reflect.DeepEqual(resp.Data, tc.wantData) {
+				t.Fatalf("expected data %#v, got %#v", tc.wantData, resp.Data)
+			}
+		})
+	}
+}
+
+func TestReadAfterDelete(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	_, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"hello": "world",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testRequest(t, b, s, logical.DeleteOperation, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp != nil {
+		t.Fatalf("expected nil response, got %#v", resp)
+	}
+}
+
+func TestList(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	for _, path := range []string{"a/b", "a/c/d", "e"} {
+		resp, err := testRequest(t, b, s, logical.UpdateOperation, path, map[string]interface{}{
+			"hello": "world",
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+	}
+
+	// Secrets of another token are in another namespace
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "f",
+		Data:        map[string]interface{}{"hello": "world"},
+		Storage:     s,
+		ClientToken: "other-token",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]string{
+		"":    {"a/", "e"},
+		"a/":  {"b", "c/"},
+		"a":   {"b", "c/"},
+		"a/c": {"d"},
+		"x/":  nil,
+	}
+
+	for path, want := range cases {
+		path, want := path, want
+		t.Run(path, func(t *testing.T) {
+			resp, err := testRequest(t, b, s, logical.ListOperation, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys, _ := resp.Data["keys"].([]string)
+			if !reflect.DeepEqual(keys, want) {
+				t.Fatalf("expected keys %v, got %v", want, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package mock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// notifier tracks changes to the secrets in storage, so that
+// watches can wait for a secret to change. Every change is
+// numbered with an index that increases for the whole mount,
+// and each key keeps the index of its last change.
+//
+// Indexes are kept in memory, so they restart when the plugin
+// does and are only comparable within one plugin process.
+type notifier struct {
+	lock     sync.Mutex
+	index    uint64
+	modified map[string]uint64
+
+	// waiters are closed on the next change to their key
+	waiters map[string]chan struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		modified: make(map[string]uint64),
+		waiters:  make(map[string]chan struct{}),
+	}
+}
+
+// notify records a change to the key and wakes its watches.
+func (n *notifier) notify(key string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.index++
+	n.modified[key] = n.index
+
+	if waiter, ok := n.waiters[key]; ok {
+		close(waiter)
+		delete(n.waiters, key)
+	}
+}
+
+// wait returns the index of the last change to the key once it
+// differs from index, which is immediately if the key changed
+// since. It returns false if the timeout or context ends first.
+func (n *notifier) wait(ctx context.Context, key string, index uint64, timeout time.Duration) (uint64, bool) {
+	n.lock.Lock()
+	if modified := n.modified[key]; modified != index {
+		n.lock.Unlock()
+		return modified, true
+	}
+
+	waiter, ok := n.waiters[key]
+	if !ok {
+		waiter = make(chan struct{})
+		n.waiters[key] = waiter
+	}
+	n.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-waiter:
+	case <-timer.C:
+		return index, false
+	case <-ctx.Done():
+		return index, false
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.modified[key], true
+}
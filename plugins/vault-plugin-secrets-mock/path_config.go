@@ -0,0 +1,212 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const configPath = "config"
+
+// Namespace modes decide which callers share stored secrets.
+const (
+	// namespaceToken scopes secrets to the client token
+	// that wrote them. This is the default.
+	namespaceToken = "token"
+
+	// namespaceEntity scopes secrets to the identity
+	// entity of the client token.
+	namespaceEntity = "entity"
+
+	// namespaceShared stores secrets once for every caller.
+	namespaceShared = "shared"
+)
+
+// defaultMaxVersions is the number of versions of a
+// versioned secret kept when no maximum is configured.
+const defaultMaxVersions = 10
+
+// mockConfig is the mount-level configuration of the backend.
+type mockConfig struct {
+	Namespace   string `json:"namespace"`
+	MaxVersions int    `json:"max_versions"`
+	SealWrap    bool   `json:"seal_wrap"`
+	Encrypt     bool   `json:"encrypt"`
+}
+
+func defaultConfig() *mockConfig {
+	return &mockConfig{
+		Namespace: namespaceToken,
+	}
+}
+
+func (b *backend) pathConfig() *framework.Path {
+	return &framework.Path{
+		Pattern: configPath,
+
+		Fields: map[string]*framework.FieldSchema{
+			"namespace": {
+				Type:          framework.TypeString,
+				Description:   `Scope of stored secrets: "token" to scope them to the client token, "entity" to the identity entity of the token, or "shared" for every caller.`,
+				Default:       namespaceToken,
+				AllowedValues: []interface{}{namespaceToken, namespaceEntity, namespaceShared},
+			},
+			"max_versions": {
+				Type:        framework.TypeInt,
+				Description: "The number of versions kept for each versioned secret. Secrets can set their own maximum in their metadata. Defaults to 10.",
+			},
+			"seal_wrap": {
+				Type:        framework.TypeBool,
+				Description: "Seal wrap secrets when they are written, if the Vault seal supports it.",
+			},
+			"encrypt": {
+				Type:        framework.TypeBool,
+				Description: "Encrypt secrets with a key generated for the mount when they are written.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.handleConfigRead,
+				Summary:  "Read the mount configuration.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.handleConfigWrite,
+				Summary:  "Configure the mount.",
+			},
+		},
+
+		HelpSynopsis:    configHelpSynopsis,
+		HelpDescription: configHelpDescription,
+	}
+}
+
+// getConfig returns the mount configuration, or the
+// default configuration if none has been written.
+func getConfig(ctx context.Context, s logical.Storage) (*mockConfig, error) {
+	entry, err := s.Get(ctx, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultConfig()
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	return config, nil
+}
+
+func (b *backend) handleConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"namespace":    config.Namespace,
+			"max_versions": config.MaxVersions,
+			"seal_wrap":    config.SealWrap,
+			"encrypt":      config.Encrypt,
+		},
+	}, nil
+}
+
+func (b *backend) handleConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace, ok := data.GetOk("namespace"); ok {
+		config.Namespace = namespace.(string)
+	}
+
+	if maxVersions, ok := data.GetOk("max_versions"); ok {
+		config.MaxVersions = maxVersions.(int)
+	}
+
+	if sealWrap, ok := data.GetOk("seal_wrap"); ok {
+		config.SealWrap = sealWrap.(bool)
+	}
+
+	if encrypt, ok := data.GetOk("encrypt"); ok {
+		config.Encrypt = encrypt.(bool)
+	}
+
+	switch config.Namespace {
+	case namespaceToken, namespaceEntity, namespaceShared:
+	default:
+		return logical.ErrorResponse("invalid namespace %q", config.Namespace), nil
+	}
+
+	if config.MaxVersions < 0 {
+		return logical.ErrorResponse("max_versions cannot be negative"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// namespace returns the storage prefix of the secrets
+// visible to the caller, according to the namespace mode.
+func (b *backend) namespace(ctx context.Context, req *logical.Request) (string, error) {
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return "", err
+	}
+
+	switch config.Namespace {
+	case namespaceEntity:
+		if req.EntityID == "" {
+			return "", fmt.Errorf("entity ID empty")
+		}
+		return "entity/" + req.EntityID + "/", nil
+	case namespaceShared:
+		return "shared/", nil
+	default:
+		if req.ClientToken == "" {
+			return "", fmt.Errorf("client token empty")
+		}
+		return req.ClientToken + "/", nil
+	}
+}
+
+const configHelpSynopsis = `
+Configures the mount.
+`
+
+const configHelpDescription = `
+The namespace decides which callers see the secrets written to the mount.
+With "token", the default, each client token has its own secrets. With
+"entity", the tokens of an identity entity share secrets. With "shared",
+every caller reads and writes the same secrets.
+
+Secrets written under one namespace mode are not visible under another.
+
+max_versions is the number of versions kept for each secret written
+through the data/ path, unless the secret sets its own maximum. It
+defaults to 10.
+
+seal_wrap and encrypt protect secrets written after they are enabled.
+With seal_wrap, Vault seal wraps the storage entries if its seal supports
+it. With encrypt, values are encrypted with AES-GCM using a key generated
+for the mount the first time it is needed, which is itself seal wrapped.
+Secrets that were encrypted can still be read after encrypt is disabled.
+`
@@ -0,0 +1,184 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testCaller is the client token and identity entity of a request.
+type testCaller struct {
+	token    string
+	entityID string
+}
+
+func testRequestAs(t *testing.T, b logical.Backend, s logical.Storage, caller testCaller, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   op,
+		Path:        path,
+		Data:        data,
+		Storage:     s,
+		ClientToken: caller.token,
+		EntityID:    caller.entityID,
+		MountPoint:  "mock-secrets/",
+	})
+}
+
+// requireVisible checks whether the caller can read and list the
+// secret at app/db written by requireNamespaces.
+func requireVisible(t *testing.T, b logical.Backend, s logical.Storage, caller testCaller, visible bool) {
+	t.Helper()
+
+	resp, err := testRequestAs(t, b, s, caller, logical.ReadOperation, "app/db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch {
+	case visible && (resp == nil || resp.Data["password"] != "secret"):
+		t.Fatalf("expected %#v to read the secret, got %#v", caller, resp)
+	case !visible && resp != nil:
+		t.Fatalf("expected %#v not to read the secret, got %#v", caller, resp.Data)
+	}
+
+	resp, err = testRequestAs(t, b, s, caller, logical.ListOperation, "app/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	if visible {
+		want = []string{"db"}
+	}
+
+	keys, _ := resp.Data["keys"].([]string)
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected %#v to list %v, got %v", caller, want, keys)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	writer := testCaller{token: "writer-token", entityID: "entity-a"}
+
+	cases := []struct {
+		namespace string
+
+		// same shares the namespace of the writer, and
+		// other does not unless every caller shares it
+		same  testCaller
+		other testCaller
+
+		otherVisible bool
+	}{
+		{
+			namespace: namespaceToken,
+			same:      testCaller{token: "writer-token", entityID: "entity-b"},
+			other:     testCaller{token: "other-token", entityID: "entity-a"},
+		},
+		{
+			namespace: namespaceEntity,
+			same:      testCaller{token: "other-token", entityID: "entity-a"},
+			other:     testCaller{token: "writer-token", entityID: "entity-b"},
+		},
+		{
+			namespace:    namespaceShared,
+			same:         testCaller{token: "other-token", entityID: "entity-b"},
+			other:        testCaller{token: "third-token"},
+			otherVisible: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.namespace, func(t *testing.T) {
+			b, s := getTestBackend(t)
+			testConfigure(t, b, s, map[string]interface{}{"namespace": tc.namespace})
+
+			resp, err := testRequestAs(t, b, s, writer, logical.UpdateOperation, "app/db", map[string]interface{}{
+				"password": "secret",
+			})
+			if err != nil || resp.IsError() {
+				t.Fatalf("err: %v, resp: %#v", err, resp)
+			}
+
+			requireVisible(t, b, s, writer, true)
+			requireVisible(t, b, s, tc.same, true)
+			requireVisible(t, b, s, tc.other, tc.otherVisible)
+
+			if !tc.otherVisible {
+				// Writes and deletes outside the namespace
+				// of the writer leave its secret untouched
+				if _, err := testRequestAs(t, b, s, tc.other, logical.UpdateOperation, "app/db", map[string]interface{}{
+					"password": "other",
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := testRequestAs(t, b, s, tc.other, logical.DeleteOperation, "app/db", nil); err != nil {
+					t.Fatal(err)
+				}
+
+				requireVisible(t, b, s, writer, true)
+			}
+
+			// A delete in the namespace of the writer removes it
+			if _, err := testRequestAs(t, b, s, tc.same, logical.DeleteOperation, "app/db", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			requireVisible(t, b, s, writer, false)
+		})
+	}
+}
+
+func TestNamespaceEntityRequired(t *testing.T) {
+	b, s := getTestBackend(t)
+	testConfigure(t, b, s, map[string]interface{}{"namespace": namespaceEntity})
+
+	caller := testCaller{token: testToken}
+
+	for _, op := range []logical.Operation{
+		logical.ReadOperation,
+		logical.UpdateOperation,
+		logical.DeleteOperation,
+		logical.ListOperation,
+	} {
+		t.Run(string(op), func(t *testing.T) {
+			resp, err := testRequestAs(t, b, s, caller, op, "app/db", map[string]interface{}{
+				"password": "secret",
+			})
+			if err == nil {
+				t.Fatalf("expected request without an entity to fail, got %#v", resp)
+			}
+		})
+	}
+
+	keys, err := s.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(keys, []string{configPath}) {
+		t.Fatalf("expected only the config to be stored, got %v", keys)
+	}
+}
+
+func TestConfigNamespaceInvalid(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, configPath, map[string]interface{}{
+		"namespace": "tenant",
+	})
+	if err == nil && !resp.IsError() {
+		t.Fatalf("expected invalid namespace to be rejected, got %#v", resp)
+	}
+
+	resp, err = testRequest(t, b, s, logical.ReadOperation, configPath, nil)
+	if err != nil || resp.Data["namespace"] != namespaceToken {
+		t.Fatalf("expected the default namespace, got err: %v, resp: %#v", err, resp)
+	}
+}
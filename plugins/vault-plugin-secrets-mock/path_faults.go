@@ -0,0 +1,513 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const faultsPath = configPath + "/faults"
+
+// Fault operations group the request operations faults are injected
+// into. Creates and updates are both writes, as in the Vault CLI.
+const (
+	faultRead   = "read"
+	faultWrite  = "write"
+	faultDelete = "delete"
+	faultList   = "list"
+	faultRenew  = "renew"
+	faultRevoke = "revoke"
+)
+
+// defaultFaultStatus is the status code of injected
+// errors that do not set their own.
+const defaultFaultStatus = http.StatusInternalServerError
+
+const defaultFaultMessage = "injected fault"
+
+// Fault states tell requests whether faults may be injected
+// without taking the fault lock.
+const (
+	// faultsUnknown means the faults have not been read from
+	// storage since the mount started or they were invalidated.
+	faultsUnknown int32 = iota
+	faultsNone
+	faultsActive
+)
+
+// faultConfig is the fault injection configuration of the mount.
+type faultConfig struct {
+	Latency     time.Duration      `json:"latency"`
+	ErrorRates  map[string]float64 `json:"error_rates"`
+	ErrorStatus int                `json:"error_status"`
+	Seed        int64              `json:"seed"`
+	Rules       []*faultRule       `json:"rules"`
+}
+
+// faultRule fails the next Count requests of an operation
+// under a path prefix. Rules without an operation match
+// every operation.
+type faultRule struct {
+	Operation string `json:"operation"`
+	Prefix    string `json:"prefix"`
+	Count     int    `json:"count"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+}
+
+func (r *faultRule) matches(operation, path string) bool {
+	return (r.Operation == "" || r.Operation == operation) && strings.HasPrefix(path, r.Prefix)
+}
+
+// active reports whether the faults can slow or fail a request.
+func (f *faultConfig) active() bool {
+	if f == nil {
+		return false
+	}
+
+	if f.Latency > 0 || len(f.Rules) > 0 {
+		return true
+	}
+
+	for _, rate := range f.ErrorRates {
+		if rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// clone copies the faults, so that a write can change
+// them without changing the cached configuration.
+func (f *faultConfig) clone() *faultConfig {
+	faults := *f
+
+	faults.ErrorRates = make(map[string]float64, len(f.ErrorRates))
+	for operation, rate := range f.ErrorRates {
+		faults.ErrorRates[operation] = rate
+	}
+
+	faults.Rules = make([]*faultRule, 0, len(f.Rules))
+	for _, rule := range f.Rules {
+		r := *rule
+		faults.Rules = append(faults.Rules, &r)
+	}
+
+	return &faults
+}
+
+func (b *backend) pathFaults() *framework.Path {
+	return &framework.Path{
+		Pattern: faultsPath,
+
+		Fields: map[string]*framework.FieldSchema{
+			"latency": {
+				Type:        framework.TypeString,
+				Description: `Delay added to every request, such as "250ms" or "2s".`,
+			},
+			"error_rates": {
+				Type:        framework.TypeMap,
+				Description: "Fraction of requests failed at random for each operation, between 0 and 1. Operations are read, write, delete, list, renew and revoke.",
+			},
+			"error_status": {
+				Type:        framework.TypeInt,
+				Description: "Status code of the errors injected by error_rates. Defaults to 500.",
+			},
+			"seed": {
+				Type:        framework.TypeInt,
+				Description: "Seed of the random failures injected by error_rates, so that they are the same on every run. A seed of 0 uses the current time.",
+			},
+			"rules": {
+				Type:        framework.TypeSlice,
+				Description: "Scripted failures, each failing the next count requests of an operation under a path prefix with a status code and message.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.handleFaultsRead,
+				Summary:  "Read the faults injected into requests.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.handleFaultsWrite,
+				Summary:  "Configure the faults injected into requests.",
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.handleFaultsDelete,
+				Summary:  "Stop injecting faults into requests.",
+			},
+		},
+
+		HelpSynopsis:    faultsHelpSynopsis,
+		HelpDescription: faultsHelpDescription,
+	}
+}
+
+// getFaults returns the fault injection configuration,
+// or nil if no faults are configured.
+func getFaults(ctx context.Context, s logical.Storage) (*faultConfig, error) {
+	entry, err := s.Get(ctx, faultsPath)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	faults := new(faultConfig)
+	if err := entry.DecodeJSON(faults); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	return faults, nil
+}
+
+func putFaults(ctx context.Context, s logical.Storage, faults *faultConfig) error {
+	entry, err := logical.StorageEntryJSON(faultsPath, faults)
+	if err != nil {
+		return errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// loadFaults returns the cached faults, reading them from storage
+// the first time. The caller must hold the fault lock.
+func (b *backend) loadFaults(ctx context.Context, s logical.Storage) (*faultConfig, error) {
+	if atomic.LoadInt32(&b.faultState) != faultsUnknown {
+		return b.faults, nil
+	}
+
+	faults, err := getFaults(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	b.setFaults(faults)
+	return faults, nil
+}
+
+// setFaults caches the faults. The caller must hold the fault lock.
+func (b *backend) setFaults(faults *faultConfig) {
+	b.faults = faults
+
+	state := faultsNone
+	if faults.active() {
+		state = faultsActive
+	}
+	atomic.StoreInt32(&b.faultState, state)
+}
+
+// resetFaults drops the cached faults and random failures,
+// so that they are read from storage again.
+func (b *backend) resetFaults() {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+
+	b.faults = nil
+	b.faultRand = nil
+	atomic.StoreInt32(&b.faultState, faultsUnknown)
+}
+
+func (b *backend) handleFaultsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+
+	faults, err := b.loadFaults(ctx, req.Storage)
+	if err != nil || faults == nil {
+		return nil, err
+	}
+
+	rules := make([]map[string]interface{}, 0, len(faults.Rules))
+	for _, rule := range faults.Rules {
+		rules = append(rules, map[string]interface{}{
+			"operation": rule.Operation,
+			"prefix":    rule.Prefix,
+			"count":     rule.Count,
+			"status":    rule.Status,
+			"message":   rule.Message,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"latency":      faults.Latency.String(),
+			"error_rates":  faults.ErrorRates,
+			"error_status": faults.ErrorStatus,
+			"seed":         faults.Seed,
+			"rules":        rules,
+		},
+	}, nil
+}
+
+func (b *backend) handleFaultsWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+
+	// Writes start from the cached faults, so that rules
+	// keep the count of requests they have left to fail
+	faults, err := b.loadFaults(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if faults == nil {
+		faults = &faultConfig{
+			ErrorStatus: defaultFaultStatus,
+		}
+	} else {
+		faults = faults.clone()
+	}
+
+	if latency, ok := data.GetOk("latency"); ok {
+		faults.Latency, err = parseutil.ParseDurationSecond(latency)
+		if err != nil {
+			return logical.ErrorResponse("invalid latency: %s", err), nil
+		}
+
+		if faults.Latency < 0 {
+			return logical.ErrorResponse("latency cannot be negative"), nil
+		}
+	}
+
+	if errorRates, ok := data.GetOk("error_rates"); ok {
+		faults.ErrorRates, err = parseErrorRates(errorRates.(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if errorStatus, ok := data.GetOk("error_status"); ok {
+		faults.ErrorStatus = errorStatus.(int)
+	}
+
+	if !validFaultStatus(faults.ErrorStatus) {
+		return logical.ErrorResponse("error_status must be between 400 and 599"), nil
+	}
+
+	if seed, ok := data.GetOk("seed"); ok {
+		faults.Seed = int64(seed.(int))
+	}
+
+	if rules, ok := data.GetOk("rules"); ok {
+		faults.Rules, err = parseFaultRules(rules.([]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if err := putFaults(ctx, req.Storage, faults); err != nil {
+		return nil, err
+	}
+
+	// Writing the faults restarts the random failures
+	// from the seed, so a scenario can be replayed.
+	b.setFaults(faults)
+	b.faultRand = newFaultRand(faults.Seed)
+
+	return nil, nil
+}
+
+func (b *backend) handleFaultsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+
+	if err := req.Storage.Delete(ctx, faultsPath); err != nil {
+		return nil, err
+	}
+
+	b.setFaults(nil)
+	b.faultRand = nil
+
+	return nil, nil
+}
+
+func parseErrorRates(raw map[string]interface{}) (map[string]float64, error) {
+	rates := make(map[string]float64, len(raw))
+	for operation, value := range raw {
+		if !validFaultOperation(operation) {
+			return nil, fmt.Errorf("invalid operation %q in error_rates", operation)
+		}
+
+		rate, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("error rate of %s must be a number between 0 and 1", operation)
+		}
+
+		rates[operation] = rate
+	}
+
+	return rates, nil
+}
+
+func parseFaultRules(raw []interface{}) ([]*faultRule, error) {
+	rules := make([]*faultRule, 0, len(raw))
+	for i, value := range raw {
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %s", i, err)
+		}
+
+		rule := &faultRule{
+			Status:  defaultFaultStatus,
+			Message: defaultFaultMessage,
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(rule); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %s", i, err)
+		}
+
+		switch {
+		case rule.Operation != "" && !validFaultOperation(rule.Operation):
+			return nil, fmt.Errorf("invalid operation %q in rule %d", rule.Operation, i)
+		case rule.Count < 1:
+			return nil, fmt.Errorf("count of rule %d must be at least 1", i)
+		case !validFaultStatus(rule.Status):
+			return nil, fmt.Errorf("status of rule %d must be between 400 and 599", i)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func validFaultOperation(operation string) bool {
+	switch operation {
+	case faultRead, faultWrite, faultDelete, faultList, faultRenew, faultRevoke:
+		return true
+	}
+	return false
+}
+
+func validFaultStatus(status int) bool {
+	return status >= 400 && status <= 599
+}
+
+// faultOperation returns the fault operation of a request, or an
+// empty string for operations that faults are not injected into.
+func faultOperation(op logical.Operation) string {
+	switch op {
+	case logical.ReadOperation:
+		return faultRead
+	case logical.CreateOperation, logical.UpdateOperation:
+		return faultWrite
+	case logical.DeleteOperation:
+		return faultDelete
+	case logical.ListOperation:
+		return faultList
+	case logical.RenewOperation:
+		return faultRenew
+	case logical.RevokeOperation:
+		return faultRevoke
+	}
+	return ""
+}
+
+func newFaultRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// injectFault waits for the configured latency and returns the error
+// of the first scripted rule matching the request, or a random error
+// according to the error rate of the operation.
+func (b *backend) injectFault(ctx context.Context, s logical.Storage, operation, path string) error {
+	latency, err := b.nextFault(ctx, s, operation, path)
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// nextFault returns the latency and error to inject into a request.
+// Requests skip the fault lock once the mount is known to have no
+// faults, so that faults cost nothing until they are configured.
+func (b *backend) nextFault(ctx context.Context, s logical.Storage, operation, path string) (time.Duration, error) {
+	if atomic.LoadInt32(&b.faultState) == faultsNone {
+		return 0, nil
+	}
+
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+
+	faults, err := b.loadFaults(ctx, s)
+	if err != nil || !faults.active() {
+		return 0, err
+	}
+
+	for i, rule := range faults.Rules {
+		if !rule.matches(operation, path) {
+			continue
+		}
+
+		// Rules are removed once they have failed their count of
+		// requests. The remaining count is only kept in memory, so
+		// that failing a request does not write to storage.
+		rule.Count--
+		if rule.Count == 0 {
+			faults.Rules = append(faults.Rules[:i], faults.Rules[i+1:]...)
+			b.setFaults(faults)
+		}
+
+		return faults.Latency, logical.CodedError(rule.Status, rule.Message)
+	}
+
+	if rate := faults.ErrorRates[operation]; rate > 0 {
+		if b.faultRand == nil {
+			b.faultRand = newFaultRand(faults.Seed)
+		}
+
+		if b.faultRand.Float64() < rate {
+			return faults.Latency, logical.CodedError(faults.ErrorStatus, defaultFaultMessage)
+		}
+	}
+
+	return faults.Latency, nil
+}
+
+const faultsHelpSynopsis = `
+Configures faults injected into requests.
+`
+
+const faultsHelpDescription = `
+Faults make requests to the mount slow or fail, so that the retry
+behavior of Vault clients can be tested.
+
+latency is added to every request. error_rates fails a fraction of the
+requests of each operation at random with error_status, 500 by default.
+Setting a seed makes the random failures the same every time the faults
+are written.
+
+rules script failures. Each rule fails the next count requests of its
+operation under its path prefix with its status and message, and is
+removed once it has failed them. Rules are checked in order before the
+error rates. A rule without an operation matches every operation. The
+counts left are kept in memory and written with the next change to the
+faults, so a restart or a change on another node starts the rules over
+from their last written counts.
+
+Operations are read, write, delete, list, renew and revoke. Requests to
+the config paths never fail. Deleting this path removes every fault.
+`
@@ -0,0 +1,251 @@
+package mock
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testConfigureFaults(t *testing.T, b logical.Backend, s logical.Storage, data map[string]interface{}) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, faultsPath, data)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+}
+
+func requireFault(t *testing.T, err error, status int) {
+	t.Helper()
+
+	coded, ok := err.(logical.HTTPCodedError)
+	if !ok || coded.Code() != status {
+		t.Fatalf("expected injected %d error, got %#v", status, err)
+	}
+}
+
+func TestFaultRules(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	testConfigureFaults(t, b, s, map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{
+				"operation": "write",
+				"prefix":    "app/",
+				"count":     2,
+				"status":    http.StatusServiceUnavailable,
+			},
+		},
+	})
+
+	data := map[string]interface{}{"hello": "world"}
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "other", data); err != nil {
+		t.Fatalf("expected writes outside the prefix to succeed, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := testRequest(t, b, s, logical.CreateOperation, "app/db", data)
+		requireFault(t, err, http.StatusServiceUnavailable)
+
+		if _, err := testRequest(t, b, s, logical.ReadOperation, "app/db", nil); err != nil {
+			t.Fatalf("expected reads to succeed, got %v", err)
+		}
+	}
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "app/db", data); err != nil {
+		t.Fatalf("expected the third write to succeed, got %v", err)
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, faultsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rules := resp.Data["rules"].([]map[string]interface{}); len(rules) != 0 {
+		t.Fatalf("expected the rule to be removed, got %#v", rules)
+	}
+}
+
+// faultsAccessStorage counts the reads and writes of the faults.
+type faultsAccessStorage struct {
+	logical.Storage
+	gets, puts int
+}
+
+func (s *faultsAccessStorage) Get(ctx context.Context, key string) (*logical.StorageEntry, error) {
+	if key == faultsPath {
+		s.gets++
+	}
+	return s.Storage.Get(ctx, key)
+}
+
+func (s *faultsAccessStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if entry.Key == faultsPath {
+		s.puts++
+	}
+	return s.Storage.Put(ctx, entry)
+}
+
+func TestFaultCache(t *testing.T) {
+	b, inmem := getTestBackend(t)
+	s := &faultsAccessStorage{Storage: inmem}
+
+	data := map[string]interface{}{"hello": "world"}
+	for i := 0; i < 3; i++ {
+		if _, err := testRequest(t, b, s, logical.UpdateOperation, "app/db", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s.gets != 1 {
+		t.Fatalf("expected the faults to be read once, got %d reads", s.gets)
+	}
+
+	testConfigureFaults(t, b, s, map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"operation": "write", "count": 2},
+		},
+	})
+	puts := s.puts
+
+	_, err := testRequest(t, b, s, logical.UpdateOperation, "app/db", data)
+	requireFault(t, err, defaultFaultStatus)
+
+	if s.puts != puts {
+		t.Fatalf("expected a failed request not to write the faults, got %d writes", s.puts-puts)
+	}
+
+	// Invalidating the faults reads them from storage again, with
+	// the count they were written with
+	b.(*backend).invalidate(context.Background(), faultsPath)
+
+	for i := 0; i < 2; i++ {
+		_, err := testRequest(t, b, s, logical.UpdateOperation, "app/db", data)
+		requireFault(t, err, defaultFaultStatus)
+	}
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "app/db", data); err != nil {
+		t.Fatalf("expected the rule to be used up, got %v", err)
+	}
+}
+
+func TestFaultErrorRates(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	testConfigureFaults(t, b, s, map[string]interface{}{
+		"error_rates":  map[string]interface{}{"read": 1, "list": 0},
+		"error_status": http.StatusTooManyRequests,
+	})
+
+	_, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	requireFault(t, err, http.StatusTooManyRequests)
+
+	if _, err := testRequest(t, b, s, logical.ListOperation, "", nil); err != nil {
+		t.Fatalf("expected lists to succeed, got %v", err)
+	}
+
+	// The config paths never fail, so faults can be removed
+	if _, err := testRequest(t, b, s, logical.ReadOperation, configPath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testRequest(t, b, s, logical.DeleteOperation, faultsPath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil); err != nil {
+		t.Fatalf("expected reads to succeed once faults are removed, got %v", err)
+	}
+}
+
+func TestFaultSeed(t *testing.T) {
+	failures := func() []bool {
+		b, s := getTestBackend(t)
+
+		testConfigureFaults(t, b, s, map[string]interface{}{
+			"error_rates": map[string]interface{}{"read": "0.5"},
+			"seed":        42,
+		})
+
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := failures(), failures()
+
+	var count int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same failures with the same seed, got %v and %v", first, second)
+		}
+		if first[i] {
+			count++
+		}
+	}
+
+	if count == 0 || count == len(first) {
+		t.Fatalf("expected some reads to fail, got %v", first)
+	}
+}
+
+func TestFaultLatency(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	testConfigureFaults(t, b, s, map[string]interface{}{
+		"latency": "50ms",
+	})
+
+	start := time.Now()
+	if _, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected at least 50ms of latency, got %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret",
+		Storage:     s,
+		ClientToken: testToken,
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected canceled request to return early, got %v", err)
+	}
+}
+
+func TestFaultValidation(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"negative latency":   {"latency": "-1s"},
+		"invalid latency":    {"latency": "soon"},
+		"unknown operation":  {"error_rates": map[string]interface{}{"patch": 0.5}},
+		"rate above one":     {"error_rates": map[string]interface{}{"read": 2}},
+		"invalid status":     {"error_status": 200},
+		"rule without count": {"rules": []interface{}{map[string]interface{}{"prefix": "app/"}}},
+		"rule unknown field": {"rules": []interface{}{map[string]interface{}{"count": 1, "path": "app/"}}},
+		"rule status":        {"rules": []interface{}{map[string]interface{}{"count": 1, "status": 302}}},
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, s := getTestBackend(t)
+
+			resp, err := testRequest(t, b, s, logical.UpdateOperation, faultsPath, data)
+			if err != nil || !resp.IsError() {
+				t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package mock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	filesPathPrefix = "files/"
+
+	// fileChunksPrefix holds the chunks of every file, under the ID
+	// of the write that stored them. Chunks are only found through
+	// the manifest of their file, so they are not namespaced.
+	fileChunksPrefix = "chunks/"
+
+	// fileChunkSize keeps chunks well under the entry size
+	// limits of Vault storage backends.
+	fileChunkSize = 256 * 1024
+
+	// maxFileSize is the largest file whose base64 encoded content
+	// fits in the default maximum request size of Vault, 32 MiB.
+	maxFileSize = 24 * 1024 * 1024
+
+	// fileReadAttempts is how many times a read starts over with the
+	// new manifest when the file is replaced while it is read.
+	fileReadAttempts = 5
+)
+
+// fileManifest describes a file stored in chunks.
+type fileManifest struct {
+	ID          string    `json:"id"`
+	Size        int       `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Chunks      int       `json:"chunks"`
+	ContentType string    `json:"content_type"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func (m *fileManifest) chunkKey(index int) string {
+	return fileChunksPrefix + m.ID + "/" + strconv.Itoa(index)
+}
+
+// data returns the manifest as returned by reads and writes.
+func (m *fileManifest) data() map[string]interface{} {
+	return map[string]interface{}{
+		"size":         m.Size,
+		"sha256":       m.SHA256,
+		"chunks":       m.Chunks,
+		"content_type": m.ContentType,
+		"created_time": m.CreatedTime,
+	}
+}
+
+func (b *backend) pathFiles() *framework.Path {
+	return &framework.Path{
+		Pattern: filesPathPrefix + framework.MatchAllRegex("path"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"path": {
+				Type:        framework.TypeString,
+				Description: "Specifies the path of the file.",
+			},
+			"content": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded content of the file.",
+			},
+			"content_type": {
+				Type:        framework.TypeString,
+				Description: "Media type of the file, returned with its content.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.handleFileRead,
+				Summary:  "Retrieve the file.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.handleFileWrite,
+				Summary:  "Store a file at the specified location.",
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.handleFileDelete,
+				Summary:  "Deletes the file at the specified location.",
+			},
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.handleFileList,
+				Summary:  "List the files and folders under the specified location.",
+			},
+		},
+
+		HelpSynopsis:    filesHelpSynopsis,
+		HelpDescription: filesHelpDescription,
+	}
+}
+
+// fileKey returns the storage key of the manifest of the file.
+func (b *backend) fileKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, error) {
+	path := data.Get("path").(string)
+	if path == "" || strings.HasSuffix(path, "/") {
+		return "", fmt.Errorf("invalid file path %q", path)
+	}
+
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return namespace + filesPathPrefix + path, nil
+}
+
+func (b *backend) getFileManifest(ctx context.Context, s logical.Storage, key string) (*fileManifest, error) {
+	entry, err := b.getEntry(ctx, s, key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	manifest := new(fileManifest)
+	if err := entry.DecodeJSON(manifest); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	return manifest, nil
+}
+
+// deleteFileChunks deletes the chunks of the manifest.
+func (b *backend) deleteFileChunks(ctx context.Context, s logical.Storage, manifest *fileManifest) error {
+	for i := 0; i < manifest.Chunks; i++ {
+		if err := s.Delete(ctx, manifest.chunkKey(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abortFileWrite deletes the chunks stored by a write that failed with
+// err. Chunks are only found through their manifest, so if they cannot
+// be deleted the error names their prefix for them to be removed.
+func (b *backend) abortFileWrite(ctx context.Context, s logical.Storage, manifest *fileManifest, err error) error {
+	if deleteErr := b.deleteFileChunks(ctx, s, manifest); deleteErr != nil {
+		return fmt.Errorf("%s, and deleting its chunks under %s failed: %s", err, fileChunksPrefix+manifest.ID+"/", deleteErr)
+	}
+	return err
+}
+
+func (b *backend) handleFileRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.fileKey(ctx, req, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Writes delete the chunks of the previous file once its manifest
+	// is replaced, so a missing chunk means the file was replaced while
+	// it was read if the manifest has changed, and the read starts over.
+	var manifest *fileManifest
+	var content []byte
+	for attempt := 1; ; attempt++ {
+		previous := manifest
+
+		manifest, err = b.getFileManifest(ctx, req.Storage, key)
+		if err != nil || manifest == nil {
+			return nil, err
+		}
+
+		var missing int
+		content, missing, err = b.readFileChunks(ctx, req.Storage, manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		if missing < 0 {
+			break
+		}
+
+		if attempt == fileReadAttempts || (previous != nil && previous.ID == manifest.ID) {
+			return nil, fmt.Errorf("chunk %d of %s is missing", missing, data.Get("path").(string))
+		}
+	}
+
+	sum := sha256.Sum256(content)
+	if len(content) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, fmt.Errorf("checksum of %s does not match its manifest", data.Get("path").(string))
+	}
+
+	resp := &logical.Response{
+		Data: manifest.data(),
+	}
+	resp.Data["content"] = base64.StdEncoding.EncodeToString(content)
+
+	return resp, nil
+}
+
+// readFileChunks reassembles the content of the manifest. It returns
+// the index of the first missing chunk, or -1 if none are missing.
+func (b *backend) readFileChunks(ctx context.Context, s logical.Storage, manifest *fileManifest) ([]byte, int, error) {
+	content := make([]byte, 0, manifest.Size)
+	for i := 0; i < manifest.Chunks; i++ {
+		chunk, err := b.getEntry(ctx, s, manifest.chunkKey(i))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if chunk == nil {
+			return nil, i, nil
+		}
+
+		content = append(content, chunk.Value...)
+	}
+
+	return content, -1, nil
+}
+
+// handleFileWrite stores the file in chunks under a new ID, then its
+// manifest, then deletes the chunks of the previous file. A read that
+// finds a chunk missing starts over with the new manifest, so that
+// reads see either the previous file or the new one.
+func (b *backend) handleFileWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.fileKey(ctx, req, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	encoded, ok := data.GetOk("content")
+	if !ok {
+		return logical.ErrorResponse("content must be provided"), nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(encoded.(string))
+	if err != nil {
+		return logical.ErrorResponse("content must be base64 encoded"), nil
+	}
+
+	if len(content) > maxFileSize {
+		return logical.ErrorResponse("files cannot be larger than %d bytes", maxFileSize), nil
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	manifest := &fileManifest{
+		ID:          id,
+		Size:        len(content),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Chunks:      (len(content) + fileChunkSize - 1) / fileChunkSize,
+		ContentType: data.Get("content_type").(string),
+		CreatedTime: time.Now().UTC(),
+	}
+
+	for i := 0; i < manifest.Chunks; i++ {
+		end := (i + 1) * fileChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		if err := b.putEntry(ctx, req.Storage, &logical.StorageEntry{
+			Key:   manifest.chunkKey(i),
+			Value: content[i*fileChunkSize : end],
+		}); err != nil {
+			return nil, b.abortFileWrite(ctx, req.Storage, manifest, err)
+		}
+	}
+
+	defer b.lockKV(key)()
+
+	previous, err := b.getFileManifest(ctx, req.Storage, key)
+	if err != nil {
+		return nil, b.abortFileWrite(ctx, req.Storage, manifest, err)
+	}
+
+	entry, err := logical.StorageEntryJSON(key, manifest)
+	if err != nil {
+		return nil, b.abortFileWrite(ctx, req.Storage, manifest, errwrap.Wrapf("json encoding failed: {{err}}", err))
+	}
+
+	if err := b.putEntry(ctx, req.Storage, entry); err != nil {
+		return nil, b.abortFileWrite(ctx, req.Storage, manifest, err)
+	}
+
+	if previous != nil {
+		if err := b.deleteFileChunks(ctx, req.Storage, previous); err != nil {
+			return nil, errwrap.Wrapf("failed to delete the previous chunks: {{err}}", err)
+		}
+	}
+
+	return &logical.Response{
+		Data: manifest.data(),
+	}, nil
+}
+
+func (b *backend) handleFileDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.fileKey(ctx, req, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	defer b.lockKV(key)()
+
+	manifest, err := b.getFileManifest(ctx, req.Storage, key)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	if err := b.deleteEntry(ctx, req.Storage, key); err != nil {
+		return nil, err
+	}
+
+	if err := b.deleteFileChunks(ctx, req.Storage, manifest); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) handleFileList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := data.Get("path").(string)
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+
+	keys, err := req.Storage.List(ctx, namespace+filesPathPrefix+path)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+const filesHelpSynopsis = `
+Stores binary and large files.
+`
+
+const filesHelpDescription = `
+Files are written as base64 encoded content, which is stored in chunks
+of 256 KiB so that files larger than the entry size limit of the Vault
+storage backend can be stored. A manifest holds the size, SHA-256
+checksum and media type of the file, and reads reassemble the chunks and
+check them against it before returning the content base64 encoded. A
+file replaced while it is read returns either its previous content or
+the new content.
+
+Files are stored separately from secrets, in the namespace of the caller,
+and can be up to 24 MiB, which is 32 MiB once base64 encoded: the default
+max_request_size of Vault. Slightly less fits with the default, since the
+request also holds the other fields.
+`
@@ -0,0 +1,268 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// failChunkStorage fails writes to the second chunk of a file, and
+// deletes of chunks if failDelete is set, to test failed writes.
+type failChunkStorage struct {
+	logical.Storage
+	failDelete bool
+}
+
+func (s *failChunkStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if strings.HasPrefix(entry.Key, fileChunksPrefix) && strings.HasSuffix(entry.Key, "/1") {
+		return fmt.Errorf("failed to write %s", entry.Key)
+	}
+	return s.Storage.Put(ctx, entry)
+}
+
+func (s *failChunkStorage) Delete(ctx context.Context, key string) error {
+	if s.failDelete && strings.HasPrefix(key, fileChunksPrefix) {
+		return fmt.Errorf("failed to delete %s", key)
+	}
+	return s.Storage.Delete(ctx, key)
+}
+
+// replaceOnReadStorage calls replace before the first read of a
+// chunk, to test reads of a file that is replaced while it is read.
+type replaceOnReadStorage struct {
+	logical.Storage
+	replace func()
+}
+
+func (s *replaceOnReadStorage) Get(ctx context.Context, key string) (*logical.StorageEntry, error) {
+	if s.replace != nil && strings.HasPrefix(key, fileChunksPrefix) {
+		replace := s.replace
+		s.replace = nil
+		replace()
+	}
+	return s.Storage.Get(ctx, key)
+}
+
+func testWriteFile(t *testing.T, b logical.Backend, s logical.Storage, path string, content []byte) *logical.Response {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, filesPathPrefix+path, map[string]interface{}{
+		"content":      base64.StdEncoding.EncodeToString(content),
+		"content_type": "application/octet-stream",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	return resp
+}
+
+func testChunkKeys(t *testing.T, s logical.Storage) []string {
+	t.Helper()
+
+	keys, err := logical.CollectKeysWithPrefix(context.Background(), s, fileChunksPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func requireFileContent(t *testing.T, b logical.Backend, s logical.Storage, path string, want []byte) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, filesPathPrefix+path, nil)
+	if err != nil || resp == nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(resp.Data["content"].(string))
+	if err != nil || !bytes.Equal(content, want) {
+		t.Fatalf("expected %d bytes of content, got %d", len(want), len(content))
+	}
+}
+
+func TestFiles(t *testing.T) {
+	b, s := getTestBackend(t)
+	testConfigure(t, b, s, map[string]interface{}{"encrypt": true})
+
+	content := make([]byte, 2*fileChunkSize+100)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := testWriteFile(t, b, s, "certs/bundle", content)
+
+	sum := sha256.Sum256(content)
+	if resp.Data["size"] != len(content) || resp.Data["chunks"] != 3 || resp.Data["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected manifest %#v", resp.Data)
+	}
+
+	if keys := testChunkKeys(t, s); len(keys) != 3 {
+		t.Fatalf("expected 3 chunks, got %v", keys)
+	}
+
+	requireFileContent(t, b, s, "certs/bundle", content)
+
+	// Chunks are encrypted like any other secret
+	for _, key := range testChunkKeys(t, s) {
+		if value := testRawEntry(t, s, key).Value; !bytes.HasPrefix(value, encryptedValuePrefix) {
+			t.Fatalf("expected %s to be encrypted", key)
+		}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.ListOperation, filesPathPrefix, nil)
+		if err != nil || !reflect.DeepEqual(resp.Data["keys"], []string{"certs/"}) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		testWriteFile(t, b, s, "certs/bundle", []byte("small"))
+		requireFileContent(t, b, s, "certs/bundle", []byte("small"))
+
+		if keys := testChunkKeys(t, s); len(keys) != 1 {
+			t.Fatalf("expected the previous chunks to be deleted, got %v", keys)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		testWriteFile(t, b, s, "empty", nil)
+		requireFileContent(t, b, s, "empty", []byte{})
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		testWriteFile(t, b, s, "corrupted", []byte("original"))
+
+		manifest, err := b.(*backend).getFileManifest(context.Background(), s, testToken+"/"+filesPathPrefix+"corrupted")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.(*backend).putEntry(context.Background(), s, &logical.StorageEntry{
+			Key:   manifest.chunkKey(0),
+			Value: []byte("tampered"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := testRequest(t, b, s, logical.ReadOperation, filesPathPrefix+"corrupted", nil); err == nil {
+			t.Fatal("expected checksum mismatch")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for _, path := range []string{"certs/bundle", "empty", "corrupted"} {
+			if _, err := testRequest(t, b, s, logical.DeleteOperation, filesPathPrefix+path, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if resp, err := testRequest(t, b, s, logical.ReadOperation, filesPathPrefix+"certs/bundle", nil); err != nil || resp != nil {
+			t.Fatalf("expected deleted file to be missing, got err: %v, resp: %#v", err, resp)
+		}
+
+		if keys := testChunkKeys(t, s); len(keys) != 0 {
+			t.Fatalf("expected no chunks, got %v", keys)
+		}
+	})
+}
+
+func TestFilesInvalid(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	cases := map[string]map[string]interface{}{
+		"missing content": {},
+		"not base64":      {"content": "not base64!"},
+		"too large":       {"content": base64.StdEncoding.EncodeToString(make([]byte, maxFileSize+1))},
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := testRequest(t, b, s, logical.UpdateOperation, filesPathPrefix+"file", data)
+			if err != nil || !resp.IsError() {
+				t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+			}
+		})
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, filesPathPrefix+"dir/", nil)
+	if err != nil || !resp.IsError() {
+		t.Fatalf("expected error response for a folder, got err: %v, resp: %#v", err, resp)
+	}
+}
+
+func TestFilesFailedWrite(t *testing.T) {
+	content := base64.StdEncoding.EncodeToString(make([]byte, 2*fileChunkSize))
+
+	t.Run("chunks deleted", func(t *testing.T) {
+		b, inmem := getTestBackend(t)
+		s := &failChunkStorage{Storage: inmem}
+
+		_, err := testRequest(t, b, s, logical.UpdateOperation, filesPathPrefix+"file", map[string]interface{}{"content": content})
+		if err == nil || strings.Contains(err.Error(), "deleting its chunks") {
+			t.Fatalf("expected the write error alone, got %v", err)
+		}
+
+		if keys := testChunkKeys(t, s); len(keys) != 0 {
+			t.Fatalf("expected the chunks of the failed write to be deleted, got %v", keys)
+		}
+	})
+
+	t.Run("chunks left", func(t *testing.T) {
+		b, inmem := getTestBackend(t)
+		s := &failChunkStorage{Storage: inmem, failDelete: true}
+
+		_, err := testRequest(t, b, s, logical.UpdateOperation, filesPathPrefix+"file", map[string]interface{}{"content": content})
+		if err == nil {
+			t.Fatal("expected write to fail")
+		}
+
+		keys := testChunkKeys(t, s)
+		if len(keys) != 1 || !strings.Contains(err.Error(), "deleting its chunks under "+strings.TrimSuffix(keys[0], "0")) {
+			t.Fatalf("expected the error to name the chunks left behind %v, got %v", keys, err)
+		}
+	})
+}
+
+func TestFilesReplacedWhileRead(t *testing.T) {
+	b, inmem := getTestBackend(t)
+
+	testWriteFile(t, b, inmem, "file", []byte("previous"))
+
+	s := &replaceOnReadStorage{
+		Storage: inmem,
+		replace: func() {
+			testWriteFile(t, b, inmem, "file", []byte("replaced"))
+		},
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, filesPathPrefix+"file", nil)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	if content := resp.Data["content"]; content != base64.StdEncoding.EncodeToString([]byte("replaced")) {
+		t.Fatalf("expected the replaced content, got %v", content)
+	}
+
+	// A chunk missing from the current manifest is still an error
+	for _, key := range testChunkKeys(t, inmem) {
+		if err := inmem.Delete(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = testRequest(t, b, inmem, logical.ReadOperation, filesPathPrefix+"file", nil)
+	if err == nil || !strings.Contains(err.Error(), "chunk 0 of file is missing") {
+		t.Fatalf("expected a missing chunk error, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Types of generated values.
+const (
+	generatePassword = "password"
+	generateUUID     = "uuid"
+	generateHex      = "hex"
+	generateBase64   = "base64"
+	generateRSA      = "rsa"
+	generateEd25519  = "ed25519"
+)
+
+const (
+	defaultPasswordLength = 20
+	defaultRandomBytes    = 32
+	defaultRSABits        = 2048
+
+	// maxGenerateLength bounds the length of passwords
+	// and the number of random bytes generated.
+	maxGenerateLength = 1024
+)
+
+// generateTemplate describes how to generate the value of a field.
+type generateTemplate struct {
+	Type string `json:"type"`
+
+	// Policy is the Vault password policy of a password. Without
+	// one, passwords are Length random letters and digits.
+	Policy string `json:"policy"`
+	Length int    `json:"length"`
+
+	// Bytes is the number of random bytes of hex and base64 values
+	Bytes int `json:"bytes"`
+
+	// Bits is the size of RSA keys
+	Bits int `json:"bits"`
+}
+
+func (b *backend) pathGenerate() *framework.Path {
+	return &framework.Path{
+		Pattern: "generate/" + framework.MatchAllRegex("path"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"path": {
+				Type:        framework.TypeString,
+				Description: "Specifies the path of the secret.",
+			},
+			"fields": {
+				Type:        framework.TypeMap,
+				Description: `Template of the secret, mapping each field to the type of value generated for it, or to an object with the "type" and its options.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.handleGenerate,
+				Summary:  "Generate and store a secret with random values.",
+			},
+		},
+
+		HelpSynopsis:    generateHelpSynopsis,
+		HelpDescription: generateHelpDescription,
+	}
+}
+
+// parseGenerateTemplate parses the template of a field, which is
+// either the type of the value or an object with its options.
+func parseGenerateTemplate(field string, raw interface{}) (*generateTemplate, error) {
+	template := new(generateTemplate)
+
+	switch v := raw.(type) {
+	case string:
+		template.Type = v
+	default:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %s", field, err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(template); err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %s", field, err)
+		}
+	}
+
+	switch template.Type {
+	case generatePassword:
+		if template.Policy != "" && template.Length != 0 {
+			return nil, fmt.Errorf("%s cannot set both a policy and a length", field)
+		}
+		if template.Length == 0 {
+			template.Length = defaultPasswordLength
+		}
+		if template.Length < 1 || template.Length > maxGenerateLength {
+			return nil, fmt.Errorf("length of %s must be between 1 and %d", field, maxGenerateLength)
+		}
+	case generateHex, generateBase64:
+		if template.Bytes == 0 {
+			template.Bytes = defaultRandomBytes
+		}
+		if template.Bytes < 1 || template.Bytes > maxGenerateLength {
+			return nil, fmt.Errorf("bytes of %s must be between 1 and %d", field, maxGenerateLength)
+		}
+	case generateRSA:
+		if template.Bits == 0 {
+			template.Bits = defaultRSABits
+		}
+		switch template.Bits {
+		case 2048, 3072, 4096:
+		default:
+			return nil, fmt.Errorf("bits of %s must be 2048, 3072 or 4096", field)
+		}
+	case generateUUID, generateEd25519:
+	default:
+		return nil, fmt.Errorf("invalid type %q for %s", template.Type, field)
+	}
+
+	return template, nil
+}
+
+// generate returns a random value according to the template.
+// Keypairs are returned as PEM encoded private and public keys.
+func (b *backend) generate(ctx context.Context, template *generateTemplate) (interface{}, error) {
+	switch template.Type {
+	case generatePassword:
+		if template.Policy != "" {
+			return b.System().GeneratePasswordFromPolicy(ctx, template.Policy)
+		}
+		return base62.Random(template.Length)
+
+	case generateUUID:
+		return uuid.GenerateUUID()
+
+	case generateHex, generateBase64:
+		buf := make([]byte, template.Bytes)
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return nil, err
+		}
+
+		if template.Type == generateHex {
+			return hex.EncodeToString(buf), nil
+		}
+		return base64.StdEncoding.EncodeToString(buf), nil
+
+	case generateRSA:
+		key, err := rsa.GenerateKey(rand.Reader, template.Bits)
+		if err != nil {
+			return nil, err
+		}
+		return keypair(key, key.Public())
+
+	case generateEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return keypair(private, public)
+	}
+
+	return nil, fmt.Errorf("invalid type %q", template.Type)
+}
+
+func keypair(private crypto.PrivateKey, public crypto.PublicKey) (map[string]interface{}, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"private_key": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		"public_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// handleGenerate generates the fields of the template and stores
+// them as a secret at the path. The values are returned only by
+// this request, so secrets are never generated over existing ones.
+func (b *backend) handleGenerate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := data.Get("path").(string)
+	if path == "" || strings.HasSuffix(path, "/") {
+		return logical.ErrorResponse("invalid secret path %q", path), nil
+	}
+
+	fields := data.Get("fields").(map[string]interface{})
+	if len(fields) == 0 {
+		return logical.ErrorResponse("fields must be provided to generate a secret"), nil
+	}
+
+	// Check every template before generating anything,
+	// in a stable order so the first error is reported.
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := make(map[string]*generateTemplate, len(fields))
+	for _, name := range names {
+		templates[name], err = parseGenerateTemplate(name, fields[name])
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	key := namespace + path
+	defer b.lockKV(key)()
+
+	existing, err := req.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return logical.ErrorResponse("a secret already exists at %s%s", req.MountPoint, path), nil
+	}
+
+	secret := make(map[string]interface{}, len(templates))
+	for _, name := range names {
+		secret[name], err = b.generate(ctx, templates[name])
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to generate %s: {{err}}", name), err)
+		}
+	}
+
+	// Reject secrets that do not match the schema of the path
+	if resp, err := validateSchema(ctx, req.Storage, path, secret); resp != nil || err != nil {
+		return resp, err
+	}
+
+	buf, err := json.Marshal(secret)
+	if err != nil {
+		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	if err := b.putEntry(ctx, req.Storage, &logical.StorageEntry{
+		Key:   key,
+		Value: buf,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: secret,
+	}, nil
+}
+
+const generateHelpSynopsis = `
+Generates and stores a secret with random values.
+`
+
+const generateHelpDescription = `
+Each field of the template is generated with its type:
+
+  password  random letters and digits of "length", 20 by default, or a
+            password from the Vault password policy named by "policy"
+  uuid      a random UUID
+  hex       "bytes" random bytes, 32 by default, hex encoded
+  base64    "bytes" random bytes, 32 by default, base64 encoded
+  rsa       an RSA keypair of "bits", 2048 by default
+  ed25519   an Ed25519 keypair
+
+Keypairs are returned as an object with the PEM encoded PKCS #8
+private_key and PKIX public_key.
+
+The secret is stored at the path and the generated values are
+returned once, in the response to this request. The client never
+sends them, so they do not appear in its request or command history.
+Secrets are not generated over existing ones.
+`
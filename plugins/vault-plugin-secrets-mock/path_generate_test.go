@@ -0,0 +1,158 @@
+package mock
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testParseKeypair(t *testing.T, value interface{}) (interface{}, interface{}) {
+	t.Helper()
+
+	pair, ok := value.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected keypair, got %#v", value)
+	}
+
+	privateBlock, _ := pem.Decode([]byte(pair["private_key"].(string)))
+	publicBlock, _ := pem.Decode([]byte(pair["public_key"].(string)))
+	if privateBlock == nil || publicBlock == nil {
+		t.Fatalf("expected PEM encoded keys, got %#v", pair)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return private, public
+}
+
+func TestGenerate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = new(logical.InmemStorage)
+	config.System.(*logical.StaticSystemView).SetPasswordPolicy("fixed", func() (string, error) {
+		return "policy-password", nil
+	})
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := config.StorageView
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "generate/app/bootstrap", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"password":    "password",
+			"short":       map[string]interface{}{"type": "password", "length": 8},
+			"from_policy": map[string]interface{}{"type": "password", "policy": "fixed"},
+			"id":          "uuid",
+			"token":       map[string]interface{}{"type": "hex", "bytes": 16},
+			"key":         "base64",
+			"rsa":         "rsa",
+			"ed25519":     "ed25519",
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	if !regexp.MustCompile("^[0-9A-Za-z]{20}$").MatchString(resp.Data["password"].(string)) {
+		t.Fatalf("unexpected password %q", resp.Data["password"])
+	}
+
+	if len(resp.Data["short"].(string)) != 8 {
+		t.Fatalf("unexpected password %q", resp.Data["short"])
+	}
+
+	if resp.Data["from_policy"] != "policy-password" {
+		t.Fatalf("expected password from policy, got %q", resp.Data["from_policy"])
+	}
+
+	if !regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$").MatchString(resp.Data["id"].(string)) {
+		t.Fatalf("unexpected uuid %q", resp.Data["id"])
+	}
+
+	if token, err := hex.DecodeString(resp.Data["token"].(string)); err != nil || len(token) != 16 {
+		t.Fatalf("unexpected hex %q", resp.Data["token"])
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(resp.Data["key"].(string)); err != nil || len(key) != defaultRandomBytes {
+		t.Fatalf("unexpected base64 %q", resp.Data["key"])
+	}
+
+	rsaPrivate, rsaPublic := testParseKeypair(t, resp.Data["rsa"])
+	if key, ok := rsaPrivate.(*rsa.PrivateKey); !ok || key.N.BitLen() != defaultRSABits || !key.PublicKey.Equal(rsaPublic) {
+		t.Fatalf("unexpected RSA keypair %#v", resp.Data["rsa"])
+	}
+
+	edPrivate, edPublic := testParseKeypair(t, resp.Data["ed25519"])
+	if key, ok := edPrivate.(ed25519.PrivateKey); !ok || !key.Public().(ed25519.PublicKey).Equal(edPublic) {
+		t.Fatalf("unexpected Ed25519 keypair %#v", resp.Data["ed25519"])
+	}
+
+	t.Run("stored", func(t *testing.T) {
+		stored, err := testRequest(t, b, s, logical.ReadOperation, "app/bootstrap", nil)
+		if err != nil || stored == nil {
+			t.Fatalf("err: %v, resp: %#v", err, stored)
+		}
+
+		if !reflect.DeepEqual(stored.Data, resp.Data) {
+			t.Fatalf("expected stored secret %#v, got %#v", resp.Data, stored.Data)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.UpdateOperation, "generate/app/bootstrap", map[string]interface{}{
+			"fields": map[string]interface{}{"password": "password"},
+		})
+		if err != nil || !resp.IsError() {
+			t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+		}
+	})
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"no fields":       {},
+		"unknown type":    {"fields": map[string]interface{}{"a": "guid"}},
+		"unknown option":  {"fields": map[string]interface{}{"a": map[string]interface{}{"type": "hex", "size": 4}}},
+		"policy length":   {"fields": map[string]interface{}{"a": map[string]interface{}{"type": "password", "policy": "p", "length": 8}}},
+		"too many bytes":  {"fields": map[string]interface{}{"a": map[string]interface{}{"type": "base64", "bytes": 4096}}},
+		"invalid bits":    {"fields": map[string]interface{}{"a": map[string]interface{}{"type": "rsa", "bits": 1024}}},
+		"missing policy":  {"fields": map[string]interface{}{"a": map[string]interface{}{"type": "password", "policy": "missing"}}},
+		"schema mismatch": {"fields": map[string]interface{}{"a": "uuid", "b": "uuid"}},
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, s := getTestBackend(t)
+			testSetSchema(t, b, s, "app/", map[string]interface{}{
+				"maxProperties": 1,
+			})
+
+			resp, err := testRequest(t, b, s, logical.UpdateOperation, "generate/app/secret", data)
+			if err == nil && !resp.IsError() {
+				t.Fatalf("expected error, got %#v", resp)
+			}
+
+			if resp, err := testRequest(t, b, s, logical.ReadOperation, "app/secret", nil); err != nil || resp != nil {
+				t.Fatalf("expected no secret to be stored, got err: %v, resp: %#v", err, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,630 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// kvMetadataPrefix holds the versioned secrets of a namespace,
+// one entry per key with its metadata and every version kept.
+// Secrets cannot be written to it directly, since paths under
+// metadata/ are routed to the versioned handlers.
+const kvMetadataPrefix = "metadata/"
+
+// kvEntry is a versioned secret, stored as in Vault KV v2.
+type kvEntry struct {
+	CurrentVersion int                `json:"current_version"`
+	OldestVersion  int                `json:"oldest_version"`
+	MaxVersions    int                `json:"max_versions"`
+	CreatedTime    time.Time          `json:"created_time"`
+	UpdatedTime    time.Time          `json:"updated_time"`
+	Versions       map[int]*kvVersion `json:"versions"`
+}
+
+// kvVersion is one version of a versioned secret. Destroyed
+// versions keep their metadata but not their data.
+type kvVersion struct {
+	Data         map[string]interface{} `json:"data,omitempty"`
+	CreatedTime  time.Time              `json:"created_time"`
+	DeletionTime time.Time              `json:"deletion_time"`
+	Destroyed    bool                   `json:"destroyed"`
+}
+
+func (v *kvVersion) deleted() bool {
+	return !v.DeletionTime.IsZero()
+}
+
+// metadata returns the metadata of the version, as
+// returned by reads and writes of the data/ path.
+func (v *kvVersion) metadata(version int) map[string]interface{} {
+	return map[string]interface{}{
+		"version":       version,
+		"created_time":  v.CreatedTime,
+		"deletion_time": formatDeletionTime(v.DeletionTime),
+		"destroyed":     v.Destroyed,
+	}
+}
+
+// formatDeletionTime returns the time a version was deleted,
+// or an empty string if it is not deleted, as KV v2 does.
+func formatDeletionTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// maxVersions returns the number of versions to keep, from the
+// secret's metadata, the mount configuration or the default.
+func (e *kvEntry) maxVersions(config *mockConfig) int {
+	switch {
+	case e.MaxVersions > 0:
+		return e.MaxVersions
+	case config.MaxVersions > 0:
+		return config.MaxVersions
+	default:
+		return defaultMaxVersions
+	}
+}
+
+// prune removes the oldest versions beyond the maximum.
+func (e *kvEntry) prune(max int) {
+	for v := range e.Versions {
+		if v <= e.CurrentVersion-max {
+			delete(e.Versions, v)
+		}
+	}
+
+	e.OldestVersion = 0
+	for v := range e.Versions {
+		if e.OldestVersion == 0 || v < e.OldestVersion {
+			e.OldestVersion = v
+		}
+	}
+}
+
+func (b *backend) kvPaths() []*framework.Path {
+	versionsField := &framework.FieldSchema{
+		Type:        framework.TypeCommaIntSlice,
+		Description: "The versions to update.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "data/" + framework.MatchAllRegex("path"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"path": {
+					Type:        framework.TypeString,
+					Description: "Specifies the path of the secret.",
+				},
+				"version": {
+					Type:        framework.TypeInt,
+					Description: "The version to read. Defaults to the current version.",
+				},
+				"data": {
+					Type:        framework.TypeMap,
+					Description: "The contents of the new version.",
+				},
+				"options": {
+					Type:        framework.TypeMap,
+					Description: `Options for the write. Set "cas" to the current version to only write if the secret has not changed since, or to 0 to only write if it does not exist.`,
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleDataRead,
+					Summary:  "Retrieve a version of the secret.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleDataWrite,
+					Summary:  "Store a new version of the secret.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleDataDelete,
+					Summary:  "Delete the current version of the secret.",
+				},
+			},
+
+			HelpSynopsis:    kvDataHelpSynopsis,
+			HelpDescription: kvDataHelpDescription,
+		},
+		{
+			Pattern: "metadata/" + framework.MatchAllRegex("path"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"path": {
+					Type:        framework.TypeString,
+					Description: "Specifies the path of the secret.",
+				},
+				"max_versions": {
+					Type:        framework.TypeInt,
+					Description: "The number of versions to keep. Defaults to the max_versions of the mount.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleMetadataRead,
+					Summary:  "Retrieve the metadata and versions of the secret.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMetadataWrite,
+					Summary:  "Configure the number of versions kept for the secret.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleMetadataDelete,
+					Summary:  "Permanently delete the secret and all of its versions.",
+				},
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleMetadataList,
+					Summary:  "List the versioned secrets and folders under the specified location.",
+				},
+			},
+
+			HelpSynopsis:    kvMetadataHelpSynopsis,
+			HelpDescription: kvMetadataHelpDescription,
+		},
+		b.kvVersionsPath("delete", versionsField, b.handleVersionsDelete, "Delete versions of the secret. They can be undeleted."),
+		b.kvVersionsPath("undelete", versionsField, b.handleVersionsUndelete, "Undelete versions of the secret."),
+		b.kvVersionsPath("destroy", versionsField, b.handleVersionsDestroy, "Permanently remove the data of versions of the secret."),
+	}
+}
+
+// kvVersionsPath returns a path that updates the given versions of a secret.
+func (b *backend) kvVersionsPath(prefix string, versionsField *framework.FieldSchema, callback framework.OperationFunc, summary string) *framework.Path {
+	return &framework.Path{
+		Pattern: prefix + "/" + framework.MatchAllRegex("path"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"path": {
+				Type:        framework.TypeString,
+				Description: "Specifies the path of the secret.",
+			},
+			"versions": versionsField,
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: callback,
+				Summary:  summary,
+			},
+		},
+
+		HelpSynopsis:    summary,
+		HelpDescription: kvVersionsHelpDescription,
+	}
+}
+
+// kvKey returns the storage key of the versioned secret at the
+// path of the request, in the caller's namespace.
+func (b *backend) kvKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, error) {
+	path := data.Get("path").(string)
+	if path == "" || strings.HasSuffix(path, "/") {
+		return "", errutil.UserError{Err: fmt.Sprintf("invalid secret path %q", path)}
+	}
+
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return namespace + kvMetadataPrefix + path, nil
+}
+
+func (b *backend) getKVEntry(ctx context.Context, s logical.Storage, key string) (*kvEntry, error) {
+	entry, err := b.getEntry(ctx, s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	kv := new(kvEntry)
+	if err := entry.DecodeJSON(kv); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	if kv.Versions == nil {
+		kv.Versions = make(map[int]*kvVersion)
+	}
+
+	return kv, nil
+}
+
+func (b *backend) putKVEntry(ctx context.Context, s logical.Storage, key string, kv *kvEntry) error {
+	entry, err := logical.StorageEntryJSON(key, kv)
+	if err != nil {
+		return errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	return b.putEntry(ctx, s, entry)
+}
+
+// lockKV locks the secret stored at key, so that concurrent writes
+// cannot both pass the check-and-set of a versioned secret, and a
+// write cannot land between the check and delete of a revocation.
+func (b *backend) lockKV(key string) func() {
+	lock := locksutil.LockForKey(b.kvLocks, key)
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (b *backend) handleDataRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := b.getKVEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	number := data.Get("version").(int)
+	if number == 0 {
+		number = kv.CurrentVersion
+	}
+
+	version, ok := kv.Versions[number]
+	if !ok {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"data":     version.Data,
+			"metadata": version.metadata(number),
+		},
+	}
+
+	// Deleted and destroyed versions are not found,
+	// but their metadata is returned with the 404.
+	if version.deleted() || version.Destroyed {
+		resp.Data["data"] = nil
+		return logical.RespondWithStatusCode(resp, req, http.StatusNotFound)
+	}
+
+	return resp, nil
+}
+
+func (b *backend) handleDataWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := data.GetOk("data")
+	if !ok {
+		return logical.ErrorResponse("no data provided"), nil
+	}
+
+	if resp, err := validateSchema(ctx, req.Storage, data.Get("path").(string), secret.(map[string]interface{})); resp != nil || err != nil {
+		return resp, err
+	}
+
+	cas, casSet, err := casOption(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.lockKV(key)()
+
+	kv, err := b.getKVEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if kv == nil {
+		kv = &kvEntry{
+			CreatedTime: now,
+			Versions:    make(map[int]*kvVersion),
+		}
+	}
+
+	if casSet && cas != kv.CurrentVersion {
+		return logical.ErrorResponse("check-and-set parameter did not match the current version"), nil
+	}
+
+	version := &kvVersion{
+		Data:        secret.(map[string]interface{}),
+		CreatedTime: now,
+	}
+
+	kv.CurrentVersion++
+	kv.Versions[kv.CurrentVersion] = version
+	kv.UpdatedTime = now
+	kv.prune(kv.maxVersions(config))
+
+	if err := b.putKVEntry(ctx, req.Storage, key, kv); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: version.metadata(kv.CurrentVersion),
+	}, nil
+}
+
+// casOption returns the check-and-set version in the
+// options of a write, and whether it was set.
+func casOption(data *framework.FieldData) (int, bool, error) {
+	options, ok := data.GetOk("options")
+	if !ok {
+		return 0, false, nil
+	}
+
+	fd := &framework.FieldData{
+		Raw: options.(map[string]interface{}),
+		Schema: map[string]*framework.FieldSchema{
+			"cas": {Type: framework.TypeInt},
+		},
+	}
+
+	cas, ok, err := fd.GetOkErr("cas")
+	if err != nil {
+		return 0, false, errwrap.Wrapf("invalid cas option: {{err}}", err)
+	}
+
+	if !ok {
+		return 0, false, nil
+	}
+
+	return cas.(int), true, nil
+}
+
+func (b *backend) handleDataDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.updateVersions(ctx, req, key, nil, func(v *kvVersion) {
+		if !v.deleted() {
+			v.DeletionTime = time.Now().UTC()
+		}
+	})
+}
+
+func (b *backend) handleVersionsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleVersions(ctx, req, data, func(v *kvVersion) {
+		if !v.deleted() {
+			v.DeletionTime = time.Now().UTC()
+		}
+	})
+}
+
+func (b *backend) handleVersionsUndelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleVersions(ctx, req, data, func(v *kvVersion) {
+		if !v.Destroyed {
+			v.DeletionTime = time.Time{}
+		}
+	})
+}
+
+func (b *backend) handleVersionsDestroy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleVersions(ctx, req, data, func(v *kvVersion) {
+		v.Destroyed = true
+		v.Data = nil
+	})
+}
+
+// handleVersions applies update to the versions listed in the request.
+func (b *backend) handleVersions(ctx context.Context, req *logical.Request, data *framework.FieldData, update func(*kvVersion)) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := data.Get("versions").([]int)
+	if len(versions) == 0 {
+		return logical.ErrorResponse("no versions provided"), nil
+	}
+
+	return b.updateVersions(ctx, req, key, versions, update)
+}
+
+// updateVersions applies update to the given versions of the secret,
+// or to its current version if none are given. Versions that do not
+// exist are ignored, as in KV v2.
+func (b *backend) updateVersions(ctx context.Context, req *logical.Request, key string, versions []int, update func(*kvVersion)) (*logical.Response, error) {
+	defer b.lockKV(key)()
+
+	kv, err := b.getKVEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	if versions == nil {
+		versions = []int{kv.CurrentVersion}
+	}
+
+	for _, number := range versions {
+		if version, ok := kv.Versions[number]; ok {
+			update(version)
+		}
+	}
+
+	kv.UpdatedTime = time.Now().UTC()
+	if err := b.putKVEntry(ctx, req.Storage, key, kv); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) handleMetadataRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := b.getKVEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	numbers := make([]int, 0, len(kv.Versions))
+	for number := range kv.Versions {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	versions := make(map[string]interface{}, len(numbers))
+	for _, number := range numbers {
+		metadata := kv.Versions[number].metadata(number)
+		delete(metadata, "version")
+		versions[strconv.Itoa(number)] = metadata
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"current_version": kv.CurrentVersion,
+			"oldest_version":  kv.OldestVersion,
+			"max_versions":    kv.MaxVersions,
+			"created_time":    kv.CreatedTime,
+			"updated_time":    kv.UpdatedTime,
+			"versions":        versions,
+		},
+	}, nil
+}
+
+func (b *backend) handleMetadataWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.lockKV(key)()
+
+	kv, err := b.getKVEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if kv == nil {
+		kv = &kvEntry{
+			CreatedTime: now,
+			Versions:    make(map[int]*kvVersion),
+		}
+	}
+
+	if maxVersions, ok := data.GetOk("max_versions"); ok {
+		kv.MaxVersions = maxVersions.(int)
+	}
+
+	if kv.MaxVersions < 0 {
+		return logical.ErrorResponse("max_versions cannot be negative"), nil
+	}
+
+	kv.UpdatedTime = now
+	kv.prune(kv.maxVersions(config))
+
+	if err := b.putKVEntry(ctx, req.Storage, key, kv); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) handleMetadataDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.kvKey(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.lockKV(key)()
+
+	if err := b.deleteEntry(ctx, req.Storage, key); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) handleMetadataList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := data.Get("path").(string)
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+
+	keys, err := req.Storage.List(ctx, namespace+kvMetadataPrefix+path)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+const kvDataHelpSynopsis = `
+Writes and reads versions of a secret, as in Vault KV v2.
+`
+
+const kvDataHelpDescription = `
+Each write to data/<path> stores a new version of the secret, and reads
+return the current version, or the version given by the version parameter.
+Deleting the path deletes the current version, which can be undeleted.
+
+Set options.cas to only write if the current version of the secret matches
+it. A cas of 0 only writes the secret if it does not exist.
+`
+
+const kvMetadataHelpSynopsis = `
+Manages the metadata and versions of a secret, as in Vault KV v2.
+`
+
+const kvMetadataHelpDescription = `
+Reading metadata/<path> returns the versions of the secret and whether they
+are deleted or destroyed. Set max_versions to limit the number of versions
+kept for the secret; the oldest versions are removed first. Deleting the
+metadata permanently removes the secret and all of its versions.
+`
+
+const kvVersionsHelpDescription = `
+Updates the versions of the secret given in the versions parameter.
+delete/<path> deletes them so that reads of them are not found until they
+are undeleted with undelete/<path>. destroy/<path> permanently removes their
+data. Versions that do not exist are ignored.
+`
@@ -0,0 +1,217 @@
+package mock
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testWriteVersion(t *testing.T, b logical.Backend, s logical.Storage, path string, data map[string]interface{}, options map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	body := map[string]interface{}{"data": data}
+	if options != nil {
+		body["options"] = options
+	}
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "data/"+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func testReadVersion(t *testing.T, b logical.Backend, s logical.Storage, path string, version int) *logical.Response {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, "data/"+path, map[string]interface{}{
+		"version": version,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func testUpdateVersions(t *testing.T, b logical.Backend, s logical.Storage, op, path string, versions ...int) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, op+"/"+path, map[string]interface{}{
+		"versions": versions,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+}
+
+func requireVersionData(t *testing.T, resp *logical.Response, want map[string]interface{}) {
+	t.Helper()
+
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected version, got %#v", resp)
+	}
+
+	if !reflect.DeepEqual(resp.Data["data"], want) {
+		t.Fatalf("expected data %#v, got %#v", want, resp.Data["data"])
+	}
+}
+
+func requireVersionNotFound(t *testing.T, resp *logical.Response) {
+	t.Helper()
+
+	if resp == nil || resp.Data[logical.HTTPStatusCode] != http.StatusNotFound {
+		t.Fatalf("expected 404, got %#v", resp)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	for i := 1; i <= 3; i++ {
+		resp := testWriteVersion(t, b, s, "app/db", map[string]interface{}{"n": strconv.Itoa(i)}, nil)
+		if resp.Data["version"] != i {
+			t.Fatalf("expected version %d, got %#v", i, resp.Data)
+		}
+	}
+
+	requireVersionData(t, testReadVersion(t, b, s, "app/db", 0), map[string]interface{}{"n": "3"})
+	requireVersionData(t, testReadVersion(t, b, s, "app/db", 1), map[string]interface{}{"n": "1"})
+
+	if resp := testReadVersion(t, b, s, "app/db", 4); resp != nil {
+		t.Fatalf("expected nil response, got %#v", resp)
+	}
+
+	t.Run("delete and undelete", func(t *testing.T) {
+		if _, err := testRequest(t, b, s, logical.DeleteOperation, "data/app/db", nil); err != nil {
+			t.Fatal(err)
+		}
+		requireVersionNotFound(t, testReadVersion(t, b, s, "app/db", 0))
+
+		testUpdateVersions(t, b, s, "delete", "app/db", 1)
+		requireVersionNotFound(t, testReadVersion(t, b, s, "app/db", 1))
+
+		testUpdateVersions(t, b, s, "undelete", "app/db", 1, 3)
+		requireVersionData(t, testReadVersion(t, b, s, "app/db", 0), map[string]interface{}{"n": "3"})
+		requireVersionData(t, testReadVersion(t, b, s, "app/db", 1), map[string]interface{}{"n": "1"})
+	})
+
+	t.Run("destroy", func(t *testing.T) {
+		testUpdateVersions(t, b, s, "destroy", "app/db", 2)
+		requireVersionNotFound(t, testReadVersion(t, b, s, "app/db", 2))
+
+		testUpdateVersions(t, b, s, "undelete", "app/db", 2)
+		requireVersionNotFound(t, testReadVersion(t, b, s, "app/db", 2))
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.ReadOperation, "metadata/app/db", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Data["current_version"] != 3 || resp.Data["oldest_version"] != 1 {
+			t.Fatalf("unexpected metadata %#v", resp.Data)
+		}
+
+		versions := resp.Data["versions"].(map[string]interface{})
+		if len(versions) != 3 || versions["2"].(map[string]interface{})["destroyed"] != true {
+			t.Fatalf("unexpected versions %#v", versions)
+		}
+
+		resp, err = testRequest(t, b, s, logical.ListOperation, "metadata/app/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(resp.Data["keys"], []string{"db"}) {
+			t.Fatalf("unexpected keys %#v", resp.Data)
+		}
+	})
+
+	t.Run("delete metadata", func(t *testing.T) {
+		if _, err := testRequest(t, b, s, logical.DeleteOperation, "metadata/app/db", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp := testReadVersion(t, b, s, "app/db", 1); resp != nil {
+			t.Fatalf("expected nil response, got %#v", resp)
+		}
+
+		resp := testWriteVersion(t, b, s, "app/db", map[string]interface{}{"n": "1"}, nil)
+		if resp.Data["version"] != 1 {
+			t.Fatalf("expected version 1, got %#v", resp.Data)
+		}
+	})
+}
+
+func TestMaxVersions(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"max_versions": 3,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	for i := 1; i <= 5; i++ {
+		testWriteVersion(t, b, s, "secret", map[string]interface{}{"n": strconv.Itoa(i)}, nil)
+	}
+
+	if resp := testReadVersion(t, b, s, "secret", 2); resp != nil {
+		t.Fatalf("expected version 2 to be pruned, got %#v", resp)
+	}
+	requireVersionData(t, testReadVersion(t, b, s, "secret", 3), map[string]interface{}{"n": "3"})
+
+	resp, err = testRequest(t, b, s, logical.UpdateOperation, "metadata/secret", map[string]interface{}{
+		"max_versions": 1,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	if resp := testReadVersion(t, b, s, "secret", 4); resp != nil {
+		t.Fatalf("expected version 4 to be pruned, got %#v", resp)
+	}
+
+	resp, err = testRequest(t, b, s, logical.ReadOperation, "metadata/secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Data["oldest_version"] != 5 || resp.Data["max_versions"] != 1 {
+		t.Fatalf("unexpected metadata %#v", resp.Data)
+	}
+}
+
+func TestCheckAndSet(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	cases := []struct {
+		name      string
+		cas       interface{}
+		wantError bool
+	}{
+		{"create when missing", 0, false},
+		{"create when present", 0, true},
+		{"stale version", 3, true},
+		{"current version", 1, false},
+		{"numeric string", "2", false},
+		{"invalid", "two", true},
+	}
+
+	for _, tc := range cases {
+		resp := testWriteVersion(t, b, s, "secret", map[string]interface{}{"case": tc.name}, map[string]interface{}{
+			"cas": tc.cas,
+		})
+
+		if resp.IsError() != tc.wantError {
+			t.Fatalf("%s: expected error %t, got %#v", tc.name, tc.wantError, resp)
+		}
+	}
+
+	requireVersionData(t, testReadVersion(t, b, s, "secret", 0), map[string]interface{}{"case": "numeric string"})
+}
@@ -0,0 +1,255 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	schemaPathPrefix = "schema/"
+
+	// schemasPath holds the schemas of every path prefix. They
+	// apply to every namespace, so they are not stored under one.
+	schemasPath = "schemas"
+)
+
+func (b *backend) schemaPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: schemaPathPrefix + "?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleSchemaList,
+					Summary:  "List the path prefixes with a schema.",
+				},
+			},
+
+			HelpSynopsis:    schemaHelpSynopsis,
+			HelpDescription: schemaHelpDescription,
+		},
+		{
+			Pattern: schemaPathPrefix + framework.MatchAllRegex("prefix"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"prefix": {
+					Type:        framework.TypeString,
+					Description: "Path prefix of the secrets that must match the schema.",
+				},
+				"schema": {
+					Type:        framework.TypeMap,
+					Description: "JSON Schema that secrets written under the prefix must match.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleSchemaRead,
+					Summary:  "Read the schema of a path prefix.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleSchemaWrite,
+					Summary:  "Set the schema of a path prefix.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleSchemaDelete,
+					Summary:  "Remove the schema of a path prefix.",
+				},
+			},
+
+			HelpSynopsis:    schemaHelpSynopsis,
+			HelpDescription: schemaHelpDescription,
+		},
+	}
+}
+
+// getSchemas returns the raw schemas by path prefix.
+func getSchemas(ctx context.Context, s logical.Storage) (map[string]json.RawMessage, error) {
+	entry, err := s.Get(ctx, schemasPath)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]json.RawMessage)
+	if entry == nil {
+		return schemas, nil
+	}
+
+	if err := entry.DecodeJSON(&schemas); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	return schemas, nil
+}
+
+func putSchemas(ctx context.Context, s logical.Storage, schemas map[string]json.RawMessage) error {
+	entry, err := logical.StorageEntryJSON(schemasPath, schemas)
+	if err != nil {
+		return errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// validateSchema checks data written to path against the schema of
+// the longest prefix of the path. It returns an error response listing
+// every field that does not match, or nil if the data is valid.
+func validateSchema(ctx context.Context, s logical.Storage, path string, data map[string]interface{}) (*logical.Response, error) {
+	schemas, err := getSchemas(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefix string
+	var raw json.RawMessage
+	for p, schema := range schemas {
+		if strings.HasPrefix(path, p) && (raw == nil || len(p) > len(prefix)) {
+			prefix, raw = p, schema
+		}
+	}
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	schema, err := parseSchema(raw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid stored schema for "+prefix+": {{err}}", err)
+	}
+
+	errs, err := schema.Validate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	// The field errors are listed in the error message, since
+	// error responses cannot carry any other data.
+	return logical.ErrorResponse("data does not match the schema of %q:\n* %s", prefix, strings.Join(errs, "\n* ")), nil
+}
+
+func (b *backend) handleSchemaList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	schemas, err := getSchemas(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make([]string, 0, len(schemas))
+	for prefix := range schemas {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	return logical.ListResponse(prefixes), nil
+}
+
+func (b *backend) handleSchemaRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	schemas, err := getSchemas(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := schemas[data.Get("prefix").(string)]
+	if !ok {
+		return nil, nil
+	}
+
+	var schema map[string]interface{}
+	if err := jsonutil.DecodeJSON(raw, &schema); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"schema": schema,
+		},
+	}, nil
+}
+
+func (b *backend) handleSchemaWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := data.Get("prefix").(string)
+	if prefix == "" {
+		return logical.ErrorResponse("prefix must be provided"), nil
+	}
+
+	schema, ok := data.GetOk("schema")
+	if !ok {
+		return logical.ErrorResponse("schema must be provided"), nil
+	}
+
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	if _, err := parseSchema(raw); err != nil {
+		return logical.ErrorResponse("invalid schema: %s", err), nil
+	}
+
+	b.schemaLock.Lock()
+	defer b.schemaLock.Unlock()
+
+	schemas, err := getSchemas(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas[prefix] = raw
+
+	if err := putSchemas(ctx, req.Storage, schemas); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) handleSchemaDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.schemaLock.Lock()
+	defer b.schemaLock.Unlock()
+
+	schemas, err := getSchemas(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := data.Get("prefix").(string)
+	if _, ok := schemas[prefix]; !ok {
+		return nil, nil
+	}
+
+	delete(schemas, prefix)
+
+	if err := putSchemas(ctx, req.Storage, schemas); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const schemaHelpSynopsis = `
+Sets the JSON Schema that secrets written under a path prefix must match.
+`
+
+const schemaHelpDescription = `
+Secrets written under a path prefix with a schema are validated against
+it before they are stored, and writes that do not match are rejected with
+an error for each field that does not match. When several prefixes match
+a path, the schema of the longest one applies. Schemas apply to secrets
+written at the mount root and through the data/ path, in every namespace.
+
+Schemas support the type, enum, const, properties, required,
+additionalProperties, minProperties, maxProperties, items, minItems,
+maxItems, minLength, maxLength, pattern, minimum and maximum keywords.
+Annotations such as title and description are ignored, and schemas with
+other keywords are rejected.
+`
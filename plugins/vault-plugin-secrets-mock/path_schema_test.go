@@ -0,0 +1,183 @@
+package mock
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testSetSchema(t *testing.T, b logical.Backend, s logical.Storage, prefix string, schema map[string]interface{}) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, schemaPathPrefix+prefix, map[string]interface{}{
+		"schema": schema,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+}
+
+var testDatabaseSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"host", "port"},
+	"properties": map[string]interface{}{
+		"host": map[string]interface{}{"type": "string", "minLength": 1},
+		"port": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 65535},
+		"tls":  map[string]interface{}{"enum": []interface{}{"disable", "require"}},
+		"replicas": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string", "pattern": "^db[0-9]+$"},
+		},
+	},
+	"additionalProperties": false,
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := parseSchema(mustMarshal(testDatabaseSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		data     map[string]interface{}
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			data: map[string]interface{}{"host": "db", "port": 5432, "tls": "require", "replicas": []interface{}{"db1"}},
+		},
+		{
+			name:     "missing required",
+			data:     map[string]interface{}{"host": "db"},
+			wantErrs: []string{"/port: is required"},
+		},
+		{
+			name:     "wrong types",
+			data:     map[string]interface{}{"host": true, "port": "5432"},
+			wantErrs: []string{"/host: expected string, got boolean", "/port: expected integer, got string"},
+		},
+		{
+			name:     "not an integer",
+			data:     map[string]interface{}{"host": "db", "port": 54.5},
+			wantErrs: []string{"/port: expected integer, got number"},
+		},
+		{
+			name: "constraints",
+			data: map[string]interface{}{"host": "", "port": 70000, "tls": "prefer", "replicas": []interface{}{"db1", "replica"}},
+			wantErrs: []string{
+				"/host: must be at least 1 characters",
+				"/port: must be at most 65535",
+				`/replicas/1: must match pattern "^db[0-9]+$"`,
+				`/tls: must be one of ["disable","require"]`,
+			},
+		},
+		{
+			name:     "additional property",
+			data:     map[string]interface{}{"host": "db", "port": 5432, "password": "secret"},
+			wantErrs: []string{"/password: is not allowed"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs, err := schema.Validate(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(errs, tc.wantErrs) {
+				t.Fatalf("expected errors %#v, got %#v", tc.wantErrs, errs)
+			}
+		})
+	}
+}
+
+func TestSchemaWrite(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	testSetSchema(t, b, s, "app/", map[string]interface{}{"type": "object"})
+	testSetSchema(t, b, s, "app/db/", testDatabaseSchema)
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "app/db/primary", map[string]interface{}{
+		"host": "db",
+	})
+	if err != nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+	}
+
+	if resp.Error().Error() != "data does not match the schema of \"app/db/\":\n* /port: is required" {
+		t.Fatalf("expected field errors, got %#v", resp.Data)
+	}
+
+	if resp, err := testRequest(t, b, s, logical.ReadOperation, "app/db/primary", nil); err != nil || resp != nil {
+		t.Fatalf("expected invalid secret not to be stored, got err: %v, resp: %#v", err, resp)
+	}
+
+	valid := map[string]interface{}{"host": "db", "port": 5432}
+
+	if resp, err := testRequest(t, b, s, logical.UpdateOperation, "app/db/primary", valid); err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// Only the schema of the longest prefix applies
+	if resp, err := testRequest(t, b, s, logical.UpdateOperation, "app/cache", map[string]interface{}{"anything": "goes"}); err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	t.Run("versioned", func(t *testing.T) {
+		resp := testWriteVersion(t, b, s, "app/db/replica", map[string]interface{}{"host": "db"}, nil)
+		if !resp.IsError() {
+			t.Fatalf("expected error response, got %#v", resp)
+		}
+
+		resp = testWriteVersion(t, b, s, "app/db/replica", map[string]interface{}{"host": "db", "port": 5433}, nil)
+		if resp.IsError() {
+			t.Fatalf("expected versioned write to succeed, got %#v", resp)
+		}
+	})
+
+	t.Run("read list and delete", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.ListOperation, "schema/", nil)
+		if err != nil || !reflect.DeepEqual(resp.Data["keys"], []string{"app/", "app/db/"}) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+
+		resp, err = testRequest(t, b, s, logical.ReadOperation, "schema/app/", nil)
+		if err != nil || !reflect.DeepEqual(resp.Data["schema"], map[string]interface{}{"type": "object"}) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+
+		if _, err := testRequest(t, b, s, logical.DeleteOperation, "schema/app/db/", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp, err := testRequest(t, b, s, logical.UpdateOperation, "app/db/primary", map[string]interface{}{"host": "db"}); err != nil || resp.IsError() {
+			t.Fatalf("expected write to succeed once the schema is removed, got err: %v, resp: %#v", err, resp)
+		}
+	})
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"unknown type":        {"type": "map"},
+		"unsupported keyword": {"oneOf": []interface{}{}},
+		"nested unsupported":  {"properties": map[string]interface{}{"a": map[string]interface{}{"anyOf": []interface{}{}}}},
+		"invalid pattern":     {"pattern": "("},
+		"invalid minimum":     {"minimum": "one"},
+	}
+
+	for name, schema := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, s := getTestBackend(t)
+
+			resp, err := testRequest(t, b, s, logical.UpdateOperation, "schema/app/", map[string]interface{}{
+				"schema": schema,
+			})
+			if err != nil || !resp.IsError() {
+				t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+			}
+		})
+	}
+}
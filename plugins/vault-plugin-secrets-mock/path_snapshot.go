@@ -0,0 +1,422 @@
+package mock
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	snapshotPath = "snapshot"
+	restorePath  = "restore"
+
+	// snapshotVersion is the version of the snapshots written.
+	// Restores reject snapshots of any other version.
+	snapshotVersion = 1
+)
+
+// snapshotAAD binds encrypted snapshot entries to the snapshot format.
+var snapshotAAD = []byte("mock-snapshot-v1")
+
+// snapshotArchive is a snapshot of every entry of a mount. Its entries
+// are the JSON encoded list of snapshotEntry, encrypted with AES-GCM
+// when the snapshot was taken with a key.
+type snapshotArchive struct {
+	Version     int       `json:"version"`
+	CreatedTime time.Time `json:"created_time"`
+	Encrypted   bool      `json:"encrypted"`
+	Nonce       []byte    `json:"nonce,omitempty"`
+	Entries     []byte    `json:"entries"`
+}
+
+// snapshotEntry is a storage entry of a snapshot. Secrets are
+// decrypted in snapshots, and encrypted again according to the
+// restored configuration when they are restored.
+type snapshotEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// isInternalKey returns whether the storage key holds mount
+// state rather than a secret.
+func isInternalKey(key string) bool {
+	switch key {
+	case configPath, faultsPath, schemasPath, encryptionKeyPath:
+		return true
+	}
+	return false
+}
+
+func (b *backend) snapshotPaths() []*framework.Path {
+	keyField := &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Base64 encoded 256-bit AES key the snapshot is encrypted with.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: snapshotPath,
+
+			Fields: map[string]*framework.FieldSchema{
+				"key": keyField,
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleSnapshot,
+					Summary:  "Take a snapshot of every entry of the mount.",
+				},
+			},
+
+			HelpSynopsis:    snapshotHelpSynopsis,
+			HelpDescription: snapshotHelpDescription,
+		},
+		{
+			Pattern: restorePath,
+
+			Fields: map[string]*framework.FieldSchema{
+				"snapshot": {
+					Type:        framework.TypeString,
+					Description: "Snapshot returned by the snapshot path.",
+				},
+				"key": keyField,
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRestore,
+					Summary:  "Replace every entry of the mount with a snapshot.",
+				},
+			},
+
+			HelpSynopsis:    snapshotHelpSynopsis,
+			HelpDescription: snapshotHelpDescription,
+		},
+	}
+}
+
+// snapshotCipher returns the cipher for a base64 encoded snapshot key.
+func snapshotCipher(encoded string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("key must be %d base64 encoded bytes", encryptionKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// collectEntries returns every entry of the mount except the mount
+// encryption key, with secrets decrypted.
+func (b *backend) collectEntries(ctx context.Context, s logical.Storage) ([]*snapshotEntry, error) {
+	keys, err := logical.CollectKeys(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	entries := make([]*snapshotEntry, 0, len(keys))
+	for _, key := range keys {
+		if key == encryptionKeyPath {
+			continue
+		}
+
+		var entry *logical.StorageEntry
+		if isInternalKey(key) {
+			entry, err = s.Get(ctx, key)
+		} else {
+			entry, err = b.getEntry(ctx, s, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil {
+			entries = append(entries, &snapshotEntry{Key: key, Value: entry.Value})
+		}
+	}
+
+	return entries, nil
+}
+
+func (b *backend) handleSnapshot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var aead cipher.AEAD
+	if key, ok := data.GetOk("key"); ok {
+		var err error
+		if aead, err = snapshotCipher(key.(string)); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	entries, err := b.collectEntries(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	archive := &snapshotArchive{
+		Version:     snapshotVersion,
+		CreatedTime: time.Now().UTC(),
+		Entries:     buf,
+	}
+
+	if aead != nil {
+		archive.Encrypted = true
+		archive.Nonce = make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, archive.Nonce); err != nil {
+			return nil, errwrap.Wrapf("failed to generate nonce: {{err}}", err)
+		}
+		archive.Entries = aead.Seal(nil, archive.Nonce, buf, snapshotAAD)
+	}
+
+	buf, err = json.Marshal(archive)
+	if err != nil {
+		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"snapshot":  base64.StdEncoding.EncodeToString(buf),
+			"version":   archive.Version,
+			"encrypted": archive.Encrypted,
+			"entries":   len(entries),
+		},
+	}, nil
+}
+
+// parseSnapshot decodes and decrypts the entries of a snapshot,
+// and checks them before anything is restored.
+func parseSnapshot(encoded, key string) ([]*snapshotEntry, error) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot is not base64 encoded")
+	}
+
+	archive := new(snapshotArchive)
+	if err := jsonutil.DecodeJSON(buf, archive); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+
+	if archive.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", archive.Version)
+	}
+
+	switch {
+	case archive.Encrypted && key == "":
+		return nil, fmt.Errorf("snapshot is encrypted, a key must be provided")
+	case !archive.Encrypted && key != "":
+		return nil, fmt.Errorf("snapshot is not encrypted")
+	case archive.Encrypted:
+		aead, err := snapshotCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(archive.Nonce) != aead.NonceSize() {
+			return nil, fmt.Errorf("invalid snapshot nonce")
+		}
+
+		archive.Entries, err = aead.Open(nil, archive.Nonce, archive.Entries, snapshotAAD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt snapshot, the key is wrong or the snapshot is corrupted")
+		}
+	}
+
+	var entries []*snapshotEntry
+	if err := jsonutil.DecodeJSON(archive.Entries, &entries); err != nil {
+		return nil, fmt.Errorf("invalid snapshot entries: %s", err)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		switch {
+		case entry == nil || entry.Key == "":
+			return nil, fmt.Errorf("snapshot has an entry without a key")
+		case entry.Key == encryptionKeyPath:
+			return nil, fmt.Errorf("snapshot cannot restore the mount encryption key")
+		case seen[entry.Key]:
+			return nil, fmt.Errorf("snapshot has more than one entry for %q", entry.Key)
+		}
+		seen[entry.Key] = true
+	}
+
+	return entries, nil
+}
+
+// handleRestore replaces every entry of the mount with the entries of
+// the snapshot. Requests wait for the restore, and if it fails partway
+// the previous entries are written back, so that the mount is never
+// seen partially restored.
+func (b *backend) handleRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	encoded, ok := data.GetOk("snapshot")
+	if !ok {
+		return logical.ErrorResponse("snapshot must be provided"), nil
+	}
+
+	entries, err := parseSnapshot(encoded.(string), data.Get("key").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	b.restoreLock.Lock()
+	defer b.restoreLock.Unlock()
+
+	previous, err := b.rawEntries(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.replaceEntries(ctx, req.Storage, entries, previous); err != nil {
+		if rollbackErr := b.rollbackEntries(ctx, req.Storage, previous); rollbackErr != nil {
+			return nil, fmt.Errorf("restore failed: %s, and rolling it back failed: %s", err, rollbackErr)
+		}
+		return nil, errwrap.Wrapf("restore failed and was rolled back: {{err}}", err)
+	}
+
+	// The faults and their random failures restart
+	// from the restored configuration
+	b.resetFaults()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"entries": len(entries),
+		},
+	}, nil
+}
+
+// rawEntries returns every entry of the mount as stored, except
+// the mount encryption key, which restores leave in place.
+func (b *backend) rawEntries(ctx context.Context, s logical.Storage) (map[string]*logical.StorageEntry, error) {
+	keys, err := logical.CollectKeys(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*logical.StorageEntry, len(keys))
+	for _, key := range keys {
+		if key == encryptionKeyPath {
+			continue
+		}
+
+		entry, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil {
+			entries[key] = entry
+		}
+	}
+
+	return entries, nil
+}
+
+// replaceEntries writes the entries of a snapshot and deletes every
+// other entry. The mount state is written first, so that secrets are
+// seal wrapped and encrypted according to the restored configuration.
+func (b *backend) replaceEntries(ctx context.Context, s logical.Storage, entries []*snapshotEntry, previous map[string]*logical.StorageEntry) error {
+	restored := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		if !isInternalKey(entry.Key) {
+			continue
+		}
+
+		if err := s.Put(ctx, &logical.StorageEntry{Key: entry.Key, Value: entry.Value}); err != nil {
+			return err
+		}
+		restored[entry.Key] = true
+	}
+
+	for _, entry := range entries {
+		if isInternalKey(entry.Key) {
+			continue
+		}
+
+		if err := b.putEntry(ctx, s, &logical.StorageEntry{Key: entry.Key, Value: entry.Value}); err != nil {
+			return err
+		}
+		restored[entry.Key] = true
+	}
+
+	for key := range previous {
+		if restored[key] {
+			continue
+		}
+
+		if err := b.deleteEntry(ctx, s, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollbackEntries writes back the entries of the mount from
+// before a failed restore, and deletes the entries it added.
+func (b *backend) rollbackEntries(ctx context.Context, s logical.Storage, previous map[string]*logical.StorageEntry) error {
+	keys, err := logical.CollectKeys(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, ok := previous[key]; ok || key == encryptionKeyPath {
+			continue
+		}
+
+		if err := b.deleteEntry(ctx, s, key); err != nil {
+			return err
+		}
+	}
+
+	for key, entry := range previous {
+		if err := s.Put(ctx, entry); err != nil {
+			return err
+		}
+		b.notifier.notify(key)
+	}
+
+	return nil
+}
+
+const snapshotHelpSynopsis = `
+Takes and restores snapshots of every entry of the mount.
+`
+
+const snapshotHelpDescription = `
+Reading the snapshot path returns a base64 encoded, versioned archive of
+every entry of the mount: the secrets of every namespace, the mount
+configuration, schemas and faults. Secrets are decrypted in the archive,
+so provide a base64 encoded 256-bit key to encrypt it with AES-GCM.
+
+Writing a snapshot to the restore path replaces every entry of the mount
+with the entries of the snapshot, including the mount configuration.
+Secrets are encrypted again with the key of the mount if the restored
+configuration enables encryption. The snapshot is checked before anything
+is written, requests wait until the restore ends, and a restore that fails
+partway is rolled back.
+
+Both paths are root paths, so a token needs the sudo capability on them
+as well as read or update.
+`
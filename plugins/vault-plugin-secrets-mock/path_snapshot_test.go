@@ -0,0 +1,174 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var testSnapshotKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, encryptionKeySize))
+
+// failPutStorage fails writes to one key, to test that
+// failed restores are rolled back.
+type failPutStorage struct {
+	logical.Storage
+	failKey string
+}
+
+func (s *failPutStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if entry.Key == s.failKey {
+		return fmt.Errorf("failed to write %s", entry.Key)
+	}
+	return s.Storage.Put(ctx, entry)
+}
+
+func testSnapshot(t *testing.T, b logical.Backend, s logical.Storage, data map[string]interface{}) string {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, snapshotPath, data)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	return resp.Data["snapshot"].(string)
+}
+
+func requireSecret(t *testing.T, b logical.Backend, s logical.Storage, path string, want interface{}) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch {
+	case want == nil && resp != nil:
+		t.Fatalf("expected no secret at %s, got %#v", path, resp.Data)
+	case want != nil && (resp == nil || resp.Data["value"] != want):
+		t.Fatalf("expected %q at %s, got %#v", want, path, resp)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	source, sourceStorage := getTestBackend(t)
+
+	testConfigure(t, source, sourceStorage, map[string]interface{}{"encrypt": true})
+	testSetSchema(t, source, sourceStorage, "app/", map[string]interface{}{"required": []interface{}{"value"}})
+	testRequest(t, source, sourceStorage, logical.UpdateOperation, "app/db", map[string]interface{}{"value": "db"})
+	testWriteVersion(t, source, sourceStorage, "app/api", map[string]interface{}{"value": "api"}, nil)
+
+	snapshot := testSnapshot(t, source, sourceStorage, map[string]interface{}{"key": testSnapshotKey})
+
+	buf, _ := base64.StdEncoding.DecodeString(snapshot)
+	if bytes.Contains(buf, []byte(`"value"`)) || bytes.Contains(buf, []byte("api")) {
+		t.Fatal("expected encrypted snapshot not to hold secrets in plaintext")
+	}
+
+	b, s := getTestBackend(t)
+	testRequest(t, b, s, logical.UpdateOperation, "stale", map[string]interface{}{"value": "stale"})
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, restorePath, map[string]interface{}{
+		"snapshot": snapshot,
+		"key":      testSnapshotKey,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// The mount configuration and schemas are restored with the secrets
+	if resp.Data["entries"] != 4 {
+		t.Fatalf("expected 4 entries, got %#v", resp.Data)
+	}
+
+	requireSecret(t, b, s, "app/db", "db")
+	requireSecret(t, b, s, "stale", nil)
+	requireVersionData(t, testReadVersion(t, b, s, "app/api", 0), map[string]interface{}{"value": "api"})
+
+	if value := testRawEntry(t, s, testToken+"/app/db").Value; !bytes.HasPrefix(value, encryptedValuePrefix) {
+		t.Fatalf("expected restored secret to be encrypted with the mount key, got %q", value)
+	}
+
+	if resp, err := testRequest(t, b, s, logical.UpdateOperation, "app/other", map[string]interface{}{"other": "value"}); err != nil || !resp.IsError() {
+		t.Fatalf("expected restored schema to reject write, got err: %v, resp: %#v", err, resp)
+	}
+}
+
+func TestSnapshotRequiresSudo(t *testing.T) {
+	b, _ := getTestBackend(t)
+
+	root := b.SpecialPaths().Root
+	for _, path := range []string{snapshotPath, restorePath} {
+		found := false
+		for _, p := range root {
+			found = found || p == path
+		}
+		if !found {
+			t.Fatalf("expected %s in Root, got %#v", path, root)
+		}
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	b, s := getTestBackend(t)
+	testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{"value": "secret"})
+
+	plain := testSnapshot(t, b, s, nil)
+	encrypted := testSnapshot(t, b, s, map[string]interface{}{"key": testSnapshotKey})
+
+	future, _ := json.Marshal(&snapshotArchive{Version: snapshotVersion + 1})
+
+	cases := map[string]map[string]interface{}{
+		"missing":        {},
+		"not base64":     {"snapshot": "???"},
+		"future version": {"snapshot": base64.StdEncoding.EncodeToString(future)},
+		"missing key":    {"snapshot": encrypted},
+		"unexpected key": {"snapshot": plain, "key": testSnapshotKey},
+		"invalid key":    {"snapshot": encrypted, "key": "c2hvcnQ="},
+		"wrong key":      {"snapshot": encrypted, "key": base64.StdEncoding.EncodeToString(make([]byte, encryptionKeySize))},
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := testRequest(t, b, s, logical.UpdateOperation, restorePath, data)
+			if err != nil || !resp.IsError() {
+				t.Fatalf("expected error response, got err: %v, resp: %#v", err, resp)
+			}
+
+			requireSecret(t, b, s, "secret", "secret")
+		})
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, snapshotPath, map[string]interface{}{"key": "c2hvcnQ="})
+	if err != nil || !resp.IsError() {
+		t.Fatalf("expected snapshot with an invalid key to fail, got err: %v, resp: %#v", err, resp)
+	}
+}
+
+func TestRestoreRollback(t *testing.T) {
+	source, sourceStorage := getTestBackend(t)
+	testRequest(t, source, sourceStorage, logical.UpdateOperation, "a", map[string]interface{}{"value": "new a"})
+	testRequest(t, source, sourceStorage, logical.UpdateOperation, "b", map[string]interface{}{"value": "new b"})
+	snapshot := testSnapshot(t, source, sourceStorage, nil)
+
+	b, inmem := getTestBackend(t)
+	testRequest(t, b, inmem, logical.UpdateOperation, "a", map[string]interface{}{"value": "old a"})
+	testRequest(t, b, inmem, logical.UpdateOperation, "stale", map[string]interface{}{"value": "stale"})
+
+	// Restoring b fails after a was restored
+	s := &failPutStorage{Storage: inmem, failKey: testToken + "/b"}
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, restorePath, map[string]interface{}{
+		"snapshot": snapshot,
+	}); err == nil {
+		t.Fatal("expected restore to fail")
+	}
+
+	requireSecret(t, b, s, "a", "old a")
+	requireSecret(t, b, s, "b", nil)
+	requireSecret(t, b, s, "stale", "stale")
+}
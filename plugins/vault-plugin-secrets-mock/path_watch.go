@@ -0,0 +1,165 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+func (b *backend) pathWatch() *framework.Path {
+	return &framework.Path{
+		Pattern: "watch/" + framework.MatchAllRegex("path"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"path": {
+				Type:        framework.TypeString,
+				Description: "Specifies the path of the secret. Versioned secrets are watched at data/<path>.",
+			},
+			"index": {
+				Type:        framework.TypeInt,
+				Description: "Index returned by the previous watch of the secret. The watch returns as soon as the secret has changed since.",
+			},
+			"timeout": {
+				Type:        framework.TypeDurationSecond,
+				Description: "How long to wait for the secret to change. Defaults to 30s, and cannot be more than 5m.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.handleWatch,
+				Summary:  "Wait for a secret to change.",
+			},
+		},
+
+		HelpSynopsis:    watchHelpSynopsis,
+		HelpDescription: watchHelpDescription,
+	}
+}
+
+// handleWatch blocks until the secret changes after the given index,
+// or the timeout ends, and returns the index of its last change with
+// its current data.
+func (b *backend) handleWatch(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	namespace, err := b.namespace(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	index := data.Get("index").(int)
+	if index < 0 {
+		return logical.ErrorResponse("index cannot be negative"), nil
+	}
+
+	timeout := defaultWatchTimeout
+	if raw, ok := data.GetOk("timeout"); ok {
+		timeout = time.Duration(raw.(int)) * time.Second
+	}
+
+	if timeout <= 0 || timeout > maxWatchTimeout {
+		return logical.ErrorResponse("timeout must be between 1s and %s", maxWatchTimeout), nil
+	}
+
+	path := data.Get("path").(string)
+	versioned := strings.HasPrefix(path, "data/")
+
+	key := namespace + path
+	if versioned {
+		key = namespace + kvMetadataPrefix + strings.TrimPrefix(path, "data/")
+	}
+
+	modified, changed := b.notifier.wait(ctx, key, uint64(index), timeout)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"index":   modified,
+			"changed": changed,
+		},
+	}
+
+	if !changed {
+		return resp, nil
+	}
+
+	if versioned {
+		err = b.watchVersion(ctx, req.Storage, key, resp)
+	} else {
+		err = b.watchSecret(ctx, req.Storage, key, resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// watchSecret adds the data of an unversioned secret to the response
+// of its watch. Secrets with a ttl are not returned as leases, so that
+// watching them does not create one lease per change.
+func (b *backend) watchSecret(ctx context.Context, s logical.Storage, key string, resp *logical.Response) error {
+	entry, err := b.getEntry(ctx, s, key)
+	if err != nil || entry == nil || len(entry.Value) == 0 {
+		return err
+	}
+
+	var secret map[string]interface{}
+	if err := jsonutil.DecodeJSON(entry.Value, &secret); err != nil {
+		return errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	resp.Data["data"] = secret
+	return nil
+}
+
+// watchVersion adds the data and metadata of the current version of
+// a versioned secret to the response of its watch. Deleted and
+// destroyed versions are returned without their data.
+func (b *backend) watchVersion(ctx context.Context, s logical.Storage, key string, resp *logical.Response) error {
+	kv, err := b.getKVEntry(ctx, s, key)
+	if err != nil || kv == nil {
+		return err
+	}
+
+	version, ok := kv.Versions[kv.CurrentVersion]
+	if !ok {
+		return nil
+	}
+
+	resp.Data["metadata"] = version.metadata(kv.CurrentVersion)
+	if !version.deleted() && !version.Destroyed {
+		resp.Data["data"] = version.Data
+	}
+
+	return nil
+}
+
+const watchHelpSynopsis = `
+Waits for a secret to change.
+`
+
+const watchHelpDescription = `
+A watch returns once the secret at the path changes, or when the timeout
+ends, with "changed" set accordingly. Its response holds the current data
+of the secret, which is empty once the secret is deleted, and the index of
+the last change to the secret.
+
+Pass the index of the previous watch to the next one, so that changes made
+between the watches are not missed: a watch returns immediately when the
+secret changed since the index. Without an index, a watch returns
+immediately if the secret has changed since the plugin started.
+
+Versioned secrets are watched at watch/data/<path>, and their response
+also holds the metadata of their current version.
+
+Indexes are kept in memory by the plugin, so they restart with it.
+`
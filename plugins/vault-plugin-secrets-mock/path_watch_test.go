@@ -0,0 +1,173 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type watchResult struct {
+	resp *logical.Response
+	err  error
+}
+
+// testWatch starts a watch of the path and returns the channel
+// its response is sent on.
+func testWatch(t *testing.T, b logical.Backend, s logical.Storage, path string, index interface{}, timeout int) <-chan watchResult {
+	t.Helper()
+
+	result := make(chan watchResult, 1)
+	go func() {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        "watch/" + path,
+			Data:        map[string]interface{}{"index": index, "timeout": timeout},
+			Storage:     s,
+			ClientToken: testToken,
+		})
+		result <- watchResult{resp, err}
+	}()
+
+	return result
+}
+
+func requireWatch(t *testing.T, result <-chan watchResult, wantChanged bool, wantData interface{}) uint64 {
+	t.Helper()
+
+	var r watchResult
+	select {
+	case r = <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not return")
+	}
+
+	if r.err != nil || r.resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", r.err, r.resp)
+	}
+
+	if r.resp.Data["changed"] != wantChanged || !reflect.DeepEqual(r.resp.Data["data"], wantData) {
+		t.Fatalf("expected changed %t with data %#v, got %#v", wantChanged, wantData, r.resp.Data)
+	}
+
+	return r.resp.Data["index"].(uint64)
+}
+
+// requireBlocked checks that a watch is still waiting.
+func requireBlocked(t *testing.T, result <-chan watchResult) {
+	t.Helper()
+
+	select {
+	case r := <-result:
+		t.Fatalf("expected watch to block, got %#v", r.resp)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	testRequest(t, b, s, logical.UpdateOperation, "app/db", map[string]interface{}{"password": "one"})
+
+	// Without an index, a changed secret is returned immediately
+	index := requireWatch(t, testWatch(t, b, s, "app/db", 0, 10), true, map[string]interface{}{"password": "one"})
+
+	result := testWatch(t, b, s, "app/db", index, 10)
+	requireBlocked(t, result)
+
+	testRequest(t, b, s, logical.UpdateOperation, "app/other", map[string]interface{}{"password": "other"})
+	requireBlocked(t, result)
+
+	testRequest(t, b, s, logical.UpdateOperation, "app/db", map[string]interface{}{"password": "two"})
+	next := requireWatch(t, result, true, map[string]interface{}{"password": "two"})
+	if next <= index {
+		t.Fatalf("expected index after %d, got %d", index, next)
+	}
+
+	t.Run("missed change", func(t *testing.T) {
+		testRequest(t, b, s, logical.UpdateOperation, "app/db", map[string]interface{}{"password": "three"})
+		requireWatch(t, testWatch(t, b, s, "app/db", index, 10), true, map[string]interface{}{"password": "three"})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.ReadOperation, "watch/app/db", map[string]interface{}{"timeout": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := testWatch(t, b, s, "app/db", int(resp.Data["index"].(uint64)), 10)
+		requireBlocked(t, result)
+
+		testRequest(t, b, s, logical.DeleteOperation, "app/db", nil)
+		requireWatch(t, result, true, nil)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		resp, err := testRequest(t, b, s, logical.ReadOperation, "watch/app/other", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		index := resp.Data["index"].(uint64)
+		if got := requireWatch(t, testWatch(t, b, s, "app/other", int(index), 1), false, nil); got != index {
+			t.Fatalf("expected index %d, got %d", index, got)
+		}
+	})
+
+	t.Run("invalidation", func(t *testing.T) {
+		result := testWatch(t, b, s, "app/replicated", 0, 10)
+		requireBlocked(t, result)
+
+		// A secret written through another node is only seen
+		// through the invalidation of its storage key.
+		if err := s.Put(context.Background(), &logical.StorageEntry{
+			Key:   testToken + "/app/replicated",
+			Value: []byte(`{"password":"replicated"}`),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		b.(*backend).invalidate(context.Background(), testToken+"/app/replicated")
+
+		requireWatch(t, result, true, map[string]interface{}{"password": "replicated"})
+	})
+}
+
+func TestWatchVersioned(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	result := testWatch(t, b, s, "data/app/db", 0, 10)
+	requireBlocked(t, result)
+
+	testWriteVersion(t, b, s, "app/db", map[string]interface{}{"password": "one"}, nil)
+	index := requireWatch(t, result, true, map[string]interface{}{"password": "one"})
+
+	result = testWatch(t, b, s, "data/app/db", index, 10)
+	testUpdateVersions(t, b, s, "delete", "app/db", 1)
+
+	r := <-result
+	if r.err != nil || r.resp.Data["data"] != nil {
+		t.Fatalf("expected deleted version without data, got err: %v, resp: %#v", r.err, r.resp)
+	}
+
+	metadata := r.resp.Data["metadata"].(map[string]interface{})
+	if metadata["version"] != 1 || metadata["deletion_time"] == "" {
+		t.Fatalf("unexpected metadata %#v", metadata)
+	}
+}
+
+func TestWatchInvalid(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	for _, data := range []map[string]interface{}{
+		{"index": -1},
+		{"timeout": 0},
+		{"timeout": "1h"},
+	} {
+		resp, err := testRequest(t, b, s, logical.ReadOperation, "watch/app/db", data)
+		if err == nil && !resp.IsError() {
+			t.Fatalf("%#v: expected error, got %#v", data, resp)
+		}
+	}
+}
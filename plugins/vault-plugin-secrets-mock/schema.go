@@ -0,0 +1,352 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+)
+
+// schemaKeywords are the JSON Schema keywords the mock understands.
+// Annotations are accepted and ignored, and any other keyword is
+// rejected rather than silently not enforced.
+var schemaKeywords = map[string]bool{
+	"type":                 true,
+	"enum":                 true,
+	"const":                true,
+	"properties":           true,
+	"required":             true,
+	"additionalProperties": true,
+	"minProperties":        true,
+	"maxProperties":        true,
+	"items":                true,
+	"minItems":             true,
+	"maxItems":             true,
+	"minLength":            true,
+	"maxLength":            true,
+	"pattern":              true,
+	"minimum":              true,
+	"maximum":              true,
+
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"format":      true,
+}
+
+var schemaTypes = map[string]bool{
+	"object":  true,
+	"array":   true,
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"null":    true,
+}
+
+// jsonSchema is a JSON Schema that secrets written under a
+// path prefix must match. It supports the keywords most used
+// to describe config blobs, listed in schemaKeywords.
+type jsonSchema struct {
+	Type                 schemaTypeList         `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                interface{}            `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	MinProperties        *int                   `json:"minProperties"`
+	MaxProperties        *int                   `json:"maxProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+
+	hasConst bool
+	pattern  *regexp.Regexp
+}
+
+// parseSchema parses and checks a JSON Schema.
+func parseSchema(raw []byte) (*jsonSchema, error) {
+	schema := new(jsonSchema)
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (s *jsonSchema) UnmarshalJSON(buf []byte) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &keywords); err != nil {
+		return fmt.Errorf("schema must be an object")
+	}
+
+	for keyword := range keywords {
+		if !schemaKeywords[keyword] {
+			return fmt.Errorf("unsupported keyword %q", keyword)
+		}
+	}
+
+	// plain has the fields of jsonSchema without its
+	// UnmarshalJSON method, so that it is not called again.
+	type plain jsonSchema
+	if err := json.Unmarshal(buf, (*plain)(s)); err != nil {
+		return err
+	}
+
+	_, s.hasConst = keywords["const"]
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+
+	return nil
+}
+
+// schemaTypeList is the type keyword, which is
+// either a single type or a list of types.
+type schemaTypeList []string
+
+func (t *schemaTypeList) UnmarshalJSON(buf []byte) error {
+	var types []string
+	if err := json.Unmarshal(buf, &types); err != nil {
+		var single string
+		if err := json.Unmarshal(buf, &single); err != nil {
+			return fmt.Errorf("type must be a string or a list of strings")
+		}
+		types = []string{single}
+	}
+
+	for _, name := range types {
+		if !schemaTypes[name] {
+			return fmt.Errorf("unknown type %q", name)
+		}
+	}
+
+	*t = types
+	return nil
+}
+
+// additionalProperties is either a boolean allowing or
+// forbidding properties not listed in properties, or the
+// schema they must match.
+type additionalProperties struct {
+	Allowed bool
+	Schema  *jsonSchema
+}
+
+func (a *additionalProperties) UnmarshalJSON(buf []byte) error {
+	if err := json.Unmarshal(buf, &a.Allowed); err == nil {
+		return nil
+	}
+
+	a.Allowed = true
+	return json.Unmarshal(buf, &a.Schema)
+}
+
+// Validate returns an error for each field of data that does
+// not match the schema. Errors are prefixed with the JSON pointer
+// of the field, such as "/servers/0/port".
+func (s *jsonSchema) Validate(data interface{}) ([]string, error) {
+	// Values are compared in their JSON form, with
+	// numbers as json.Number, as Vault decodes them.
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := jsonutil.DecodeJSON(buf, &value); err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	s.validate("", value, &errs)
+	return errs, nil
+}
+
+func (s *jsonSchema) validate(pointer string, value interface{}, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		field := pointer
+		if field == "" {
+			field = "/"
+		}
+		*errs = append(*errs, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), jsonType(value))
+		return
+	}
+
+	if s.Enum != nil && !containsJSON(s.Enum, value) {
+		fail("must be one of %s", mustMarshal(s.Enum))
+	}
+
+	if s.hasConst && !equalJSON(s.Const, value) {
+		fail("must be %s", mustMarshal(s.Const))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(pointer, v, fail, errs)
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(pointer+"/"+strconv.Itoa(i), item, errs)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.Pattern)
+		}
+
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			fail("invalid number %s", v)
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func (s *jsonSchema) validateObject(pointer string, v map[string]interface{}, fail func(string, ...interface{}), errs *[]string) {
+	if s.MinProperties != nil && len(v) < *s.MinProperties {
+		fail("must have at least %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(v) > *s.MaxProperties {
+		fail("must have at most %d properties", *s.MaxProperties)
+	}
+
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			*errs = append(*errs, pointer+"/"+escapePointer(name)+": is required")
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := pointer + "/" + escapePointer(name)
+
+		if property, ok := s.Properties[name]; ok {
+			property.validate(field, v[name], errs)
+			continue
+		}
+
+		switch {
+		case s.AdditionalProperties == nil:
+		case !s.AdditionalProperties.Allowed:
+			*errs = append(*errs, field+": is not allowed")
+		case s.AdditionalProperties.Schema != nil:
+			s.AdditionalProperties.Schema.validate(field, v[name], errs)
+		}
+	}
+}
+
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	actual := jsonType(value)
+	for _, name := range s.Type {
+		switch {
+		case name == actual:
+			return true
+		case name == "number" && actual == "integer":
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a decoded value.
+// Numbers without a fractional part are integers.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if n, err := v.Float64(); err == nil && n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsJSON(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equalJSON(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares values by their JSON encoding, which
+// sorts object keys, so that numbers decoded differently
+// compare equal.
+func equalJSON(a, b interface{}) bool {
+	return bytes.Equal(mustMarshal(a), mustMarshal(b))
+}
+
+func mustMarshal(value interface{}) []byte {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return []byte(fmt.Sprint(value))
+	}
+	return buf
+}
+
+// escapePointer escapes a property name for a JSON pointer.
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
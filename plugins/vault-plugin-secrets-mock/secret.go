@@ -0,0 +1,154 @@
+package mock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// secretType is the type of the leases returned when
+	// a secret written with a ttl is read.
+	secretType = "mock_secret"
+
+	// secretKeyInternalData is the lease internal data key
+	// holding the storage key of the secret, since revocations
+	// are not made with the token that read it.
+	secretKeyInternalData = "key"
+
+	// secretDigestInternalData is the lease internal data key
+	// holding the digest of the secret when it was read, so that
+	// revoking the lease leaves a secret written since alone.
+	secretDigestInternalData = "digest"
+)
+
+func (b *backend) secret() *framework.Secret {
+	return &framework.Secret{
+		Type:   secretType,
+		Renew:  b.handleSecretRenew,
+		Revoke: b.handleSecretRevoke,
+	}
+}
+
+// secretTTL returns the ttl stored with a secret, or zero if the
+// secret was written without one.
+func secretTTL(data map[string]interface{}) (time.Duration, error) {
+	raw, ok := data["ttl"]
+	if !ok {
+		return 0, nil
+	}
+
+	ttl, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, errwrap.Wrapf("invalid ttl: {{err}}", err)
+	}
+
+	return ttl, nil
+}
+
+// secretDigest identifies the value a secret had when it was read.
+// Plain secrets are stored without a version or write time, so the
+// digest of the decrypted value stands in for one.
+func secretDigest(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// leaseResponse returns a secret written with a ttl as a lease.
+// Revoking the lease deletes the secret stored at key, as long as
+// its value still has the digest it had when it was read.
+func (b *backend) leaseResponse(key, digest string, data map[string]interface{}, ttl time.Duration) *logical.Response {
+	resp := b.Secret(secretType).Response(data, map[string]interface{}{
+		secretKeyInternalData:    key,
+		secretDigestInternalData: digest,
+	})
+	resp.Secret.TTL = ttl
+
+	return resp
+}
+
+// leaseKey returns the storage key of the secret a lease was issued for.
+func leaseKey(req *logical.Request) (string, error) {
+	raw, ok := req.Secret.InternalData[secretKeyInternalData]
+	if !ok {
+		return "", fmt.Errorf("secret is missing %s internal data", secretKeyInternalData)
+	}
+
+	key, ok := raw.(string)
+	if !ok || key == "" {
+		return "", fmt.Errorf("invalid value for %s in secret internal data", secretKeyInternalData)
+	}
+
+	return key, nil
+}
+
+// handleSecretRenew extends the lease by the current ttl of the
+// secret, and fails once the secret has been deleted.
+func (b *backend) handleSecretRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := leaseKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := b.getEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return logical.ErrorResponse("secret no longer exists"), nil
+	}
+
+	var stored map[string]interface{}
+	if err := entry.DecodeJSON(&stored); err != nil {
+		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	ttl, err := secretTTL(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = ttl
+
+	return resp, nil
+}
+
+// handleSecretRevoke deletes the secret the lease was issued for,
+// unless it has been written again or deleted since it was read.
+func (b *backend) handleSecretRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := leaseKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, ok := req.Secret.InternalData[secretDigestInternalData].(string)
+	if !ok || digest == "" {
+		return nil, fmt.Errorf("invalid value for %s in secret internal data", secretDigestInternalData)
+	}
+
+	defer b.lockKV(key)()
+
+	entry, err := b.getEntry(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil || secretDigest(entry.Value) != digest {
+		return nil, nil
+	}
+
+	if err := b.deleteEntry(ctx, req.Storage, key); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
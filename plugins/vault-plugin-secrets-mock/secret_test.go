@@ -0,0 +1,171 @@
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestLeasedSecret(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"hello": "world",
+		"ttl":   "1h",
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	resp, err = testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour || !resp.Secret.Renewable {
+		t.Fatalf("expected renewable lease with a ttl of 1h, got %#v", resp.Secret)
+	}
+
+	if resp.Data["hello"] != "world" {
+		t.Fatalf("unexpected data %#v", resp.Data)
+	}
+
+	secret := resp.Secret
+
+	t.Run("renew", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RenewOperation,
+			Storage:   s,
+			Secret:    secret,
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+
+		if resp.Secret.TTL != time.Hour {
+			t.Fatalf("expected ttl of 1h, got %s", resp.Secret.TTL)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   s,
+			Secret:    secret,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+		if err != nil || resp != nil {
+			t.Fatalf("expected secret to be deleted, got err: %v, resp: %#v", err, resp)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RenewOperation,
+			Storage:   s,
+			Secret:    secret,
+		})
+		if err == nil && !resp.IsError() {
+			t.Fatalf("expected renewal of a revoked lease to fail, got %#v", resp)
+		}
+	})
+
+	t.Run("malformed internal data", func(t *testing.T) {
+		for _, internal := range []map[string]interface{}{
+			{"secret_type": secretType},
+			{"secret_type": secretType, secretKeyInternalData: 1},
+		} {
+			for _, op := range []logical.Operation{logical.RenewOperation, logical.RevokeOperation} {
+				_, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation: op,
+					Storage:   s,
+					Secret:    &logical.Secret{InternalData: internal},
+				})
+				if err == nil {
+					t.Fatalf("%s: expected error for internal data %#v", op, internal)
+				}
+			}
+		}
+	})
+}
+
+func TestLeasedSecretRewritten(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"hello": "first",
+		"ttl":   "1h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := resp.Secret
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"hello": "second",
+		"ttl":   "1h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Revoking the lease of the first value leaves the second alone
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	if err != nil || resp == nil || resp.Data["hello"] != "second" {
+		t.Fatalf("expected the rewritten secret to be kept, got err: %v, resp: %#v", err, resp)
+	}
+
+	// A lease without the digest of the secret cannot be revoked
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret: &logical.Secret{InternalData: map[string]interface{}{
+			"secret_type":         secretType,
+			secretKeyInternalData: "secret",
+		}},
+	})
+	if err == nil {
+		t.Fatal("expected error for a lease without a digest")
+	}
+}
+
+func TestSecretWithoutTTL(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"ttl": "-1h",
+	})
+	if err == nil && !resp.IsError() {
+		t.Fatalf("expected negative ttl to be rejected, got %#v", resp)
+	}
+
+	if _, err := testRequest(t, b, s, logical.UpdateOperation, "secret", map[string]interface{}{
+		"hello": "world",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = testRequest(t, b, s, logical.ReadOperation, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Secret != nil {
+		t.Fatalf("expected no lease, got %#v", resp.Secret)
+	}
+}
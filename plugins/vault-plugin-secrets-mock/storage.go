@@ -0,0 +1,175 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// encryptionKeyPath holds the AES-256 key that secrets are
+	// encrypted with. It is listed in SealWrapStorage, so Vault
+	// seal wraps it when the seal supports it.
+	encryptionKeyPath = "keyring"
+
+	encryptionKeySize = 32
+)
+
+// encryptedValuePrefix marks stored values encrypted with the
+// mount key. Values without it are plain JSON, written before
+// encryption was enabled.
+var encryptedValuePrefix = []byte("mock:aes-gcm:v1:")
+
+// getEntry reads a secret from storage and decrypts its value.
+func (b *backend) getEntry(ctx context.Context, s logical.Storage, key string) (*logical.StorageEntry, error) {
+	entry, err := s.Get(ctx, key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(entry.Value, encryptedValuePrefix) {
+		return entry, nil
+	}
+
+	aead, err := b.encryptionKey(ctx, s, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if aead == nil {
+		return nil, fmt.Errorf("%s is encrypted but the encryption key is missing", key)
+	}
+
+	value := entry.Value[len(encryptedValuePrefix):]
+	if len(value) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s is encrypted but too short", key)
+	}
+
+	nonce, ciphertext := value[:aead.NonceSize()], value[aead.NonceSize():]
+	entry.Value, err = aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to decrypt %s: {{err}}", key), err)
+	}
+
+	return entry, nil
+}
+
+// putEntry writes a secret to storage, seal wrapped and
+// encrypted according to the mount configuration, and wakes
+// the watches of the secret.
+func (b *backend) putEntry(ctx context.Context, s logical.Storage, entry *logical.StorageEntry) error {
+	config, err := getConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	entry.SealWrap = config.SealWrap
+
+	if config.Encrypt {
+		aead, err := b.encryptionKey(ctx, s, true)
+		if err != nil {
+			return err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return errwrap.Wrapf("failed to generate nonce: {{err}}", err)
+		}
+
+		value := append([]byte{}, encryptedValuePrefix...)
+		value = append(value, nonce...)
+		entry.Value = aead.Seal(value, nonce, entry.Value, []byte(entry.Key))
+	}
+
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	b.notifier.notify(entry.Key)
+	return nil
+}
+
+// deleteEntry deletes a secret from storage and
+// wakes the watches of the secret.
+func (b *backend) deleteEntry(ctx context.Context, s logical.Storage, key string) error {
+	if err := s.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	b.notifier.notify(key)
+	return nil
+}
+
+// encryptionKey returns the cipher for the mount key. The key
+// is generated and stored the first time it is needed to encrypt
+// a secret, so that mounts that never encrypt have no key.
+func (b *backend) encryptionKey(ctx context.Context, s logical.Storage, create bool) (cipher.AEAD, error) {
+	b.keyLock.RLock()
+	aead := b.aead
+	b.keyLock.RUnlock()
+
+	if aead != nil {
+		return aead, nil
+	}
+
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	if b.aead != nil {
+		return b.aead, nil
+	}
+
+	entry, err := s.Get(ctx, encryptionKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	switch {
+	case entry != nil:
+		key = entry.Value
+	case !create:
+		return nil, nil
+	default:
+		key = make([]byte, encryptionKeySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errwrap.Wrapf("failed to generate encryption key: {{err}}", err)
+		}
+
+		if err := s.Put(ctx, &logical.StorageEntry{
+			Key:      encryptionKeyPath,
+			Value:    key,
+			SealWrap: true,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid encryption key: {{err}}", err)
+	}
+
+	b.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.aead, nil
+}
+
+// resetEncryptionKey drops the cached mount key, so that
+// it is read from storage again when it is next needed.
+func (b *backend) resetEncryptionKey() {
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	b.aead = nil
+}
@@ -0,0 +1,144 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testConfigure(t *testing.T, b logical.Backend, s logical.Storage, data map[string]interface{}) {
+	t.Helper()
+
+	resp, err := testRequest(t, b, s, logical.UpdateOperation, "config", data)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+}
+
+func testRawEntry(t *testing.T, s logical.Storage, key string) *logical.StorageEntry {
+	t.Helper()
+
+	entry, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry == nil {
+		t.Fatalf("expected entry at %s", key)
+	}
+	return entry
+}
+
+// sealWrapStorage records which entries were written seal
+// wrapped, since InmemStorage does not keep the flag.
+type sealWrapStorage struct {
+	logical.Storage
+	sealWrapped map[string]bool
+}
+
+func newSealWrapStorage(s logical.Storage) *sealWrapStorage {
+	return &sealWrapStorage{
+		Storage:     s,
+		sealWrapped: make(map[string]bool),
+	}
+}
+
+func (s *sealWrapStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	s.sealWrapped[entry.Key] = entry.SealWrap
+	return s.Storage.Put(ctx, entry)
+}
+
+func TestSealWrap(t *testing.T) {
+	b, inmem := getTestBackend(t)
+	s := newSealWrapStorage(inmem)
+
+	testRequest(t, b, s, logical.UpdateOperation, "before", map[string]interface{}{"hello": "world"})
+	testConfigure(t, b, s, map[string]interface{}{"seal_wrap": true})
+	testRequest(t, b, s, logical.UpdateOperation, "after", map[string]interface{}{"hello": "world"})
+	testWriteVersion(t, b, s, "versioned", map[string]interface{}{"hello": "world"}, nil)
+
+	if s.sealWrapped[testToken+"/before"] {
+		t.Fatal("expected secret written before seal_wrap was enabled not to be seal wrapped")
+	}
+
+	for _, key := range []string{testToken + "/after", testToken + "/" + kvMetadataPrefix + "versioned"} {
+		if !s.sealWrapped[key] {
+			t.Fatalf("expected %s to be seal wrapped", key)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	b, inmem := getTestBackend(t)
+	s := newSealWrapStorage(inmem)
+
+	testRequest(t, b, s, logical.UpdateOperation, "before", map[string]interface{}{"hello": "world"})
+
+	if entry, _ := s.Get(context.Background(), encryptionKeyPath); entry != nil {
+		t.Fatal("expected no encryption key before encrypt is enabled")
+	}
+
+	testConfigure(t, b, s, map[string]interface{}{"encrypt": true})
+	testRequest(t, b, s, logical.UpdateOperation, "after", map[string]interface{}{"hello": "world"})
+	testWriteVersion(t, b, s, "versioned", map[string]interface{}{"hello": "world"}, nil)
+
+	key := testRawEntry(t, s, encryptionKeyPath)
+	if len(key.Value) != encryptionKeySize || !s.sealWrapped[encryptionKeyPath] {
+		t.Fatalf("expected a seal wrapped %d byte key, got %#v", encryptionKeySize, key)
+	}
+
+	specialPaths := b.SpecialPaths()
+	if len(specialPaths.SealWrapStorage) != 1 || specialPaths.SealWrapStorage[0] != encryptionKeyPath {
+		t.Fatalf("expected %s in SealWrapStorage, got %#v", encryptionKeyPath, specialPaths.SealWrapStorage)
+	}
+
+	for _, key := range []string{testToken + "/after", testToken + "/" + kvMetadataPrefix + "versioned"} {
+		value := testRawEntry(t, s, key).Value
+		if !bytes.HasPrefix(value, encryptedValuePrefix) || bytes.Contains(value, []byte("world")) {
+			t.Fatalf("expected %s to be encrypted, got %q", key, value)
+		}
+	}
+
+	// Secrets are readable whether or not they were encrypted,
+	// including after encryption is disabled and the key has to
+	// be loaded from storage again.
+	testConfigure(t, b, s, map[string]interface{}{"encrypt": false})
+	b.(*backend).invalidate(context.Background(), encryptionKeyPath)
+	if b.(*backend).aead != nil {
+		t.Fatal("expected invalidation to drop the cached key")
+	}
+
+	for _, path := range []string{"before", "after"} {
+		resp, err := testRequest(t, b, s, logical.ReadOperation, path, nil)
+		if err != nil || resp == nil || resp.Data["hello"] != "world" {
+			t.Fatalf("%s: err: %v, resp: %#v", path, err, resp)
+		}
+	}
+	requireVersionData(t, testReadVersion(t, b, s, "versioned", 0), map[string]interface{}{"hello": "world"})
+
+	t.Run("tampered", func(t *testing.T) {
+		entry := testRawEntry(t, s, testToken+"/after")
+		entry.Value[len(entry.Value)-1] ^= 0xff
+		if err := s.Put(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := testRequest(t, b, s, logical.ReadOperation, "after", nil); err == nil {
+			t.Fatal("expected tampered secret to fail to decrypt")
+		}
+	})
+
+	t.Run("moved", func(t *testing.T) {
+		entry := testRawEntry(t, s, testToken+"/"+kvMetadataPrefix+"versioned")
+		entry.Key = testToken + "/moved"
+		if err := s.Put(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := testRequest(t, b, s, logical.ReadOperation, "moved", nil); err == nil {
+			t.Fatal("expected secret moved to another key to fail to decrypt")
+		}
+	})
+}